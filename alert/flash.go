@@ -0,0 +1,174 @@
+package alert
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Level is the severity of a flash message. It determines how the message
+// is styled.
+type Level string
+
+const (
+	LevelInfo    Level = "info"
+	LevelSuccess Level = "success"
+	LevelWarning Level = "warning"
+	LevelDanger  Level = "danger"
+)
+
+// DefaultFlashCookie is the name of the cookie flashes are stored in if
+// Flasher.CookieName isn't set.
+const DefaultFlashCookie = "flash"
+
+// Flash is a message shown to the user once, on the next page they view.
+type Flash struct {
+	Level   Level  `json:"level"`
+	Message string `json:"message"`
+}
+
+// Class returns the CSS class for the flash's level. Unknown levels are
+// shown as LevelInfo.
+func (f Flash) Class() string {
+	switch f.Level {
+	case LevelSuccess, LevelWarning, LevelDanger:
+		return "alert-" + string(f.Level)
+	default:
+		return "alert-" + string(LevelInfo)
+	}
+}
+
+// Flasher stores flash messages in a signed cookie so they survive a
+// redirect.
+type Flasher struct {
+	// Key signs the cookie so users can't forge messages. It must be kept
+	// secret.
+	Key        []byte
+	CookieName string
+	// Insecure leaves the Secure attribute off flash cookies so that
+	// browsers send them over plain HTTP. It should only be set when
+	// developing locally.
+	Insecure bool
+}
+
+// GenerateKey returns a random key suitable for Flasher.Key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (f *Flasher) cookieName() string {
+	if f.CookieName == "" {
+		return DefaultFlashCookie
+	}
+	return f.CookieName
+}
+
+// SetFlash adds a message to the response, to be shown by the next page
+// that renders flashes. It may be called several times before the response
+// is written; messages are shown in the order they were set. Messages from
+// earlier responses that haven't been shown yet are replaced.
+func (f *Flasher) SetFlash(w http.ResponseWriter, level Level, msg string) {
+	name := f.cookieName()
+	flashes := f.pending(w.Header(), name)
+	flashes = append(flashes, Flash{Level: level, Message: msg})
+	f.setCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    f.encode(flashes),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   !f.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Flashes returns the messages set by earlier responses and clears them,
+// so they are only shown once. Cookies that have been tampered with are
+// cleared and ignored.
+func (f *Flasher) Flashes(w http.ResponseWriter, r *http.Request) []Flash {
+	name := f.cookieName()
+	c, err := r.Cookie(name)
+	if err != nil {
+		return nil
+	}
+	f.setCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !f.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	flashes, ok := f.decode(c.Value)
+	if !ok {
+		return nil
+	}
+	return flashes
+}
+
+// pending returns the flashes already set on the response headers.
+func (f *Flasher) pending(h http.Header, name string) []Flash {
+	res := http.Response{Header: http.Header{"Set-Cookie": h["Set-Cookie"]}}
+	for _, c := range res.Cookies() {
+		if c.Name == name && c.MaxAge >= 0 {
+			flashes, _ := f.decode(c.Value)
+			return flashes
+		}
+	}
+	return nil
+}
+
+// setCookie sets c, replacing any cookie with the same name already set on
+// the response.
+func (f *Flasher) setCookie(w http.ResponseWriter, c *http.Cookie) {
+	h := w.Header()
+	var keep []string
+	for _, line := range h["Set-Cookie"] {
+		if !strings.HasPrefix(line, c.Name+"=") {
+			keep = append(keep, line)
+		}
+	}
+	h["Set-Cookie"] = keep
+	http.SetCookie(w, c)
+}
+
+func (f *Flasher) encode(flashes []Flash) string {
+	// Marshaling a []Flash can't fail.
+	b, _ := json.Marshal(flashes)
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + f.sign(payload)
+}
+
+func (f *Flasher) decode(value string) ([]Flash, bool) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return nil, false
+	}
+	payload, sig := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(f.sign(payload))) {
+		return nil, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+	var flashes []Flash
+	if err := json.Unmarshal(b, &flashes); err != nil {
+		return nil, false
+	}
+	return flashes, true
+}
+
+func (f *Flasher) sign(payload string) string {
+	mac := hmac.New(sha256.New, f.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,18 +1,47 @@
 package alert
 
 import (
-	"fmt"
+	"embed"
+	"io/fs"
 	"net/http"
 	"sync"
+
+	"github.com/joncalhoun/twg/view"
 )
 
+//go:embed templates
+var templates embed.FS
+
 type App struct {
 	sync.Once
 	mux http.ServeMux
+
+	// Flasher stores flash messages between requests. If it is nil, one is
+	// created with a random key, so flashes won't survive a restart.
+	Flasher *Flasher
+
+	views *view.Engine
 }
 
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.Once.Do(func() {
+		if a.Flasher == nil {
+			key, err := GenerateKey()
+			if err != nil {
+				panic(err)
+			}
+			a.Flasher = &Flasher{Key: key}
+		}
+		tplFS, err := fs.Sub(templates, "templates")
+		if err != nil {
+			panic(err)
+		}
+		a.views = &view.Engine{
+			FS: tplFS,
+			Flashes: func(w http.ResponseWriter, r *http.Request) interface{} {
+				return a.Flasher.Flashes(w, r)
+			},
+		}
 		a.mux = http.ServeMux{}
 		a.mux.HandleFunc("/", a.Home)
 		a.mux.HandleFunc("/alert", a.WithAlert)
@@ -21,42 +50,19 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.mux.ServeHTTP(w, r)
 }
 
-func (a App) ManyAlerts(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, `
-	<html>
-		<head><title>Alert Page</title></head>
-		<body>
-			<div class="alert alert-primary" role="alert">
-				Alert Number 1
-			</div>
-			<div class="alert alert-primary" role="alert">
-				Alert Number 2
-			</div>
-			<h1>Alert page</h1>
-		</body>
-	</html>`)
+func (a *App) ManyAlerts(w http.ResponseWriter, r *http.Request) {
+	a.Flasher.SetFlash(w, LevelInfo, "Alert Number 1")
+	a.Flasher.SetFlash(w, LevelWarning, "Alert Number 2")
+	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-func (a App) WithAlert(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, `
-	<html>
-		<head><title>Alert Page</title></head>
-		<body>
-			<div class="alert alert-primary" role="alert">
-				Stuff went wrong!
-			</div>
-			<h1>Alert page</h1>
-		</body>
-	</html>`)
+func (a *App) WithAlert(w http.ResponseWriter, r *http.Request) {
+	a.Flasher.SetFlash(w, LevelDanger, "Stuff went wrong!")
+	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-func (a App) Home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, `
-	<html>
-		<head><title>Home Page</title></head>
-		<body>
-			<h1>Welcome</h1>
-			<p>This is the home page</p>
-		</body>
-	</html>`)
+func (a *App) Home(w http.ResponseWriter, r *http.Request) {
+	a.views.Render(w, r, http.StatusOK, "home.gohtml", struct {
+		Title string
+	}{"Home Page"})
 }
@@ -9,82 +9,42 @@ import (
 	"testing"
 
 	"github.com/joncalhoun/twg/alert"
-	"golang.org/x/net/html"
+	"github.com/joncalhoun/twg/htmltest"
 )
 
-func getText(n *html.Node) string {
-	var ret []string
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		switch c.Type {
-		case html.TextNode:
-			ret = append(ret, strings.TrimSpace(c.Data))
-		case html.ElementNode:
-			getText(c)
-		}
-	}
-	return strings.Join(ret, " ")
-}
-
-func findNodes(body, tag, class string) ([]string, error) {
-	// Source adapted from the html package's examples
-	doc, err := html.Parse(strings.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	var ret []string
-	var find func(n *html.Node)
-	find = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == tag {
-			for _, a := range n.Attr {
-				if a.Key == "class" {
-					classes := strings.Fields(a.Val)
-					for _, c := range classes {
-						if c == class {
-							ret = append(ret, getText(n))
-						}
-					}
-					break
-				}
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			find(c)
-		}
-	}
-	find(doc)
-	return ret, nil
-}
-
 // See https://golang.org/src/net/http/httptest/recorder_test.go for more
 // examples
 func TestApp(t *testing.T) {
 	app := alert.App{}
 
-	type checkFn func(r *http.Response, body string) error
+	type checkFn func(t *testing.T, r *http.Response, body string)
 	hasNoAlerts := func() checkFn {
-		return func(r *http.Response, body string) error {
-			nodes, err := findNodes(body, "div", "alert")
-			if err != nil {
-				return fmt.Errorf("findNodes() err = %s", err)
-			}
-			if len(nodes) != 0 {
-				return fmt.Errorf("len(alerts)=%d; want len(alerts)=0", len(nodes))
+		return func(t *testing.T, r *http.Response, body string) {
+			t.Helper()
+			htmltest.Parse(t, body).CountIs("div.alert", 0)
+		}
+	}
+	hasAlert := func(level alert.Level, msg string) checkFn {
+		return func(t *testing.T, r *http.Response, body string) {
+			t.Helper()
+			sel := "div.alert.alert-" + string(level)
+			for _, text := range htmltest.Parse(t, body).Texts(sel) {
+				if text == msg {
+					return
+				}
 			}
-			return nil
+			t.Errorf("missing %s alert: %q", level, msg)
 		}
 	}
-	hasAlert := func(msg string) checkFn {
-		return func(r *http.Response, body string) error {
-			nodes, err := findNodes(body, "div", "alert")
-			if err != nil {
-				return fmt.Errorf("findNodes() err = %s", err)
+	redirectsTo := func(location string) checkFn {
+		return func(t *testing.T, r *http.Response, body string) {
+			t.Helper()
+			if r.StatusCode != http.StatusFound {
+				t.Errorf("StatusCode=%d; want %d", r.StatusCode, http.StatusFound)
 			}
-			for _, node := range nodes {
-				if node == msg {
-					return nil
-				}
+			if got := r.Header.Get("Location"); got != location {
+				t.Errorf("Location=%q; want %q", got, location)
 			}
-			return fmt.Errorf("missing alert: %q", msg)
 		}
 	}
 
@@ -93,29 +53,139 @@ func TestApp(t *testing.T) {
 		path   string
 		body   io.Reader
 		checks []checkFn
+		// follow is checked against the page the response redirects to,
+		// requested with any cookies the response set.
+		follow []checkFn
 	}{
-		{http.MethodGet, "/", nil, []checkFn{hasNoAlerts()}},
-		{http.MethodGet, "/alert", nil, []checkFn{hasAlert("Stuff went wrong!")}},
-		{http.MethodGet, "/many", nil, []checkFn{hasAlert("Alert Number 1"), hasAlert("Alert Number 2")}},
+		{http.MethodGet, "/", nil, []checkFn{hasNoAlerts()}, nil},
+		{http.MethodGet, "/alert", nil, []checkFn{redirectsTo("/")}, []checkFn{hasAlert(alert.LevelDanger, "Stuff went wrong!")}},
+		{http.MethodGet, "/many", nil, []checkFn{redirectsTo("/")}, []checkFn{hasAlert(alert.LevelInfo, "Alert Number 1"), hasAlert(alert.LevelWarning, "Alert Number 2")}},
 	}
 	for _, tc := range tests {
 		t.Run(fmt.Sprintf("%s %s", tc.method, tc.path), func(t *testing.T) {
-			w := httptest.NewRecorder()
 			r, err := http.NewRequest(tc.method, tc.path, tc.body)
 			if err != nil {
 				t.Fatalf("http.NewRequest() err = %s", err)
 			}
-			app.ServeHTTP(w, r)
-			res := w.Result()
-			defer res.Body.Close()
-			var sb strings.Builder
-			io.Copy(&sb, res.Body)
-
+			res, body := serve(&app, r)
 			for _, check := range tc.checks {
-				if err := check(res, sb.String()); err != nil {
-					t.Error(err)
+				check(t, res, body)
+			}
+			if tc.follow == nil {
+				return
+			}
+
+			r = httptest.NewRequest(http.MethodGet, res.Header.Get("Location"), nil)
+			for _, c := range res.Cookies() {
+				r.AddCookie(c)
+			}
+			res, body = serve(&app, r)
+			for _, check := range tc.follow {
+				check(t, res, body)
+			}
+
+			// Flashes are only shown once, so reloading the page with the
+			// cookies it set shouldn't show them again.
+			r = httptest.NewRequest(http.MethodGet, r.URL.Path, nil)
+			for _, c := range res.Cookies() {
+				if c.MaxAge >= 0 {
+					r.AddCookie(c)
 				}
 			}
+			res, body = serve(&app, r)
+			t.Run("reload", func(t *testing.T) {
+				hasNoAlerts()(t, res, body)
+			})
 		})
 	}
 }
+
+func serve(h http.Handler, r *http.Request) (*http.Response, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	res := w.Result()
+	defer res.Body.Close()
+	var sb strings.Builder
+	io.Copy(&sb, res.Body)
+	return res, sb.String()
+}
+
+func TestFlasher(t *testing.T) {
+	f := &alert.Flasher{Key: []byte("test-key")}
+	w := httptest.NewRecorder()
+	f.SetFlash(w, alert.LevelSuccess, "Saved")
+	f.SetFlash(w, alert.LevelDanger, "But something <b>else</b> failed")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("len(cookies) = %d; want 1", len(cookies))
+	}
+	if c := cookies[0]; !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie HttpOnly, Secure, SameSite = %t, %t, %v; want true, true, %v", c.HttpOnly, c.Secure, c.SameSite, http.SameSiteLaxMode)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		got := f.Flashes(w, r)
+		want := []alert.Flash{
+			{Level: alert.LevelSuccess, Message: "Saved"},
+			{Level: alert.LevelDanger, Message: "But something <b>else</b> failed"},
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Flashes() = %v; want %v", got, want)
+		}
+		cleared := w.Result().Cookies()
+		if len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+			t.Fatalf("cookies = %v; want the flash cookie cleared", cleared)
+		}
+		if !cleared[0].Secure {
+			t.Errorf("cleared cookie Secure = false; want true")
+		}
+	})
+
+	t.Run("insecure", func(t *testing.T) {
+		f := &alert.Flasher{Key: []byte("test-key"), Insecure: true}
+		w := httptest.NewRecorder()
+		f.SetFlash(w, alert.LevelInfo, "Hi")
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("len(cookies) = %d; want 1", len(cookies))
+		}
+		if cookies[0].Secure {
+			t.Errorf("cookie Secure = true; want false")
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		other := &alert.Flasher{Key: []byte("other-key")}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookies[0])
+		if got := other.Flashes(httptest.NewRecorder(), r); got != nil {
+			t.Errorf("Flashes() with another key = %v; want nil", got)
+		}
+		for _, value := range []string{"", "garbage", "x" + cookies[0].Value} {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: value})
+			if got := f.Flashes(httptest.NewRecorder(), r); got != nil {
+				t.Errorf("Flashes() with cookie %q = %v; want nil", value, got)
+			}
+		}
+	})
+}
+
+func TestFlash_Class(t *testing.T) {
+	tests := map[alert.Level]string{
+		alert.LevelInfo:    "alert-info",
+		alert.LevelSuccess: "alert-success",
+		alert.LevelWarning: "alert-warning",
+		alert.LevelDanger:  "alert-danger",
+		"":                 "alert-info",
+		"bogus":            "alert-info",
+	}
+	for level, want := range tests {
+		if got := (alert.Flash{Level: level}).Class(); got != want {
+			t.Errorf("Flash{Level: %q}.Class() = %q; want %q", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package apikey manages API keys for accounts.
+//
+// An API key looks like "<id>.<secret>". The ID is used to look the key up
+// and is safe to show to users, for example when listing their keys. Only
+// a SHA-256 hash of the secret is ever stored, so a leaked Store can't be
+// used to authenticate. Secrets are long random strings rather than
+// passwords, so a fast hash is sufficient.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a key doesn't exist or its secret is
+	// wrong.
+	ErrNotFound = errors.New("apikey: not found")
+	ErrExpired  = errors.New("apikey: expired")
+	ErrRevoked  = errors.New("apikey: revoked")
+)
+
+// Key is a stored API key. The zero ExpiresAt means the key never expires
+// and the zero RevokedAt means it hasn't been revoked.
+type Key struct {
+	ID         string
+	AccountID  int
+	Hash       []byte
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists API keys. Get, Touch and Revoke return ErrNotFound if
+// there is no key with the ID.
+type Store interface {
+	Create(k *Key) error
+	Get(id string) (*Key, error)
+	// ByAccount returns every key belonging to the account, including
+	// expired and revoked keys, ordered by creation time.
+	ByAccount(accountID int) ([]Key, error)
+	// Touch sets the key's LastUsedAt.
+	Touch(id string, at time.Time) error
+	// Revoke sets the key's RevokedAt if it isn't already set.
+	Revoke(id string, at time.Time) error
+}
+
+// Manager creates and authenticates API keys.
+type Manager struct {
+	Store Store
+}
+
+// Generate creates a new key for the account with the given scopes. If ttl
+// is zero the key never expires. The returned string is the only time the
+// full key is available; it can't be recovered from the Store.
+func (m *Manager) Generate(accountID int, scopes []string, ttl time.Duration) (string, *Key, error) {
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	for _, b := range [][]byte{idBytes, secretBytes} {
+		if _, err := rand.Read(b); err != nil {
+			return "", nil, fmt.Errorf("apikey: generating key: %w", err)
+		}
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	now := time.Now()
+	k := &Key{
+		ID:        id,
+		AccountID: accountID,
+		Hash:      hash(secret),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		k.ExpiresAt = now.Add(ttl)
+	}
+	err := m.Store.Create(k)
+	if err != nil {
+		return "", nil, err
+	}
+	return id + "." + secret, k, nil
+}
+
+// Authenticate returns the key for the full API key and records that it
+// was used. ErrNotFound is returned for unknown or malformed keys, and
+// ErrExpired or ErrRevoked for keys that can no longer be used.
+func (m *Manager) Authenticate(apiKey string) (*Key, error) {
+	parts := strings.Split(apiKey, ".")
+	if len(parts) != 2 {
+		return nil, ErrNotFound
+	}
+	id, secret := parts[0], parts[1]
+	k, err := m.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(k.Hash, hash(secret)) != 1 {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	if !k.RevokedAt.IsZero() {
+		return nil, ErrRevoked
+	}
+	if !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	err = m.Store.Touch(k.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	k.LastUsedAt = now
+	return k, nil
+}
+
+// Revoke stops the key with the ID from being used.
+func (m *Manager) Revoke(id string) error {
+	return m.Store.Revoke(id, time.Now())
+}
+
+// List returns the account's keys.
+func (m *Manager) List(accountID int) ([]Key, error) {
+	return m.Store.ByAccount(accountID)
+}
+
+func hash(secret string) []byte {
+	h := sha256.Sum256([]byte(secret))
+	return h[:]
+}
+
+// MemStore stores keys in memory. The zero value is ready to use and it is
+// safe for concurrent use.
+type MemStore struct {
+	mu   sync.Mutex
+	keys []*Key
+}
+
+func (ms *MemStore) Create(k *Key) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored := *k
+	stored.Scopes = append([]string(nil), k.Scopes...)
+	ms.keys = append(ms.keys, &stored)
+	return nil
+}
+
+func (ms *MemStore) Get(id string) (*Key, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	k := ms.find(id)
+	if k == nil {
+		return nil, ErrNotFound
+	}
+	ret := *k
+	return &ret, nil
+}
+
+func (ms *MemStore) ByAccount(accountID int) ([]Key, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var ret []Key
+	for _, k := range ms.keys {
+		if k.AccountID == accountID {
+			ret = append(ret, *k)
+		}
+	}
+	return ret, nil
+}
+
+func (ms *MemStore) Touch(id string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	k := ms.find(id)
+	if k == nil {
+		return ErrNotFound
+	}
+	k.LastUsedAt = at
+	return nil
+}
+
+func (ms *MemStore) Revoke(id string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	k := ms.find(id)
+	if k == nil {
+		return ErrNotFound
+	}
+	if k.RevokedAt.IsZero() {
+		k.RevokedAt = at
+	}
+	return nil
+}
+
+// find must be called with ms.mu held.
+func (ms *MemStore) find(id string) *Key {
+	for _, k := range ms.keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries the key.
+func NewContext(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, ctxKey{}, k)
+}
+
+// FromContext returns the key stored in ctx by NewContext, or nil if
+// there isn't one.
+func FromContext(ctx context.Context) *Key {
+	k, _ := ctx.Value(ctxKey{}).(*Key)
+	return k
+}
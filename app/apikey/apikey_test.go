@@ -0,0 +1,115 @@
+package apikey_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/twg/app/apikey"
+)
+
+func TestManager_Generate(t *testing.T) {
+	m := &apikey.Manager{Store: &apikey.MemStore{}}
+	plaintext, k, err := m.Generate(7, []string{"admin"}, 0)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	if !strings.HasPrefix(plaintext, k.ID+".") {
+		t.Errorf("Generate() key = %q; want it to start with the ID %q", plaintext, k.ID)
+	}
+	stored, err := m.Store.Get(k.ID)
+	if err != nil {
+		t.Fatalf("Get() err = %s; want nil", err)
+	}
+	if strings.Contains(string(stored.Hash), strings.TrimPrefix(plaintext, k.ID+".")) {
+		t.Errorf("stored Hash contains the plaintext secret")
+	}
+
+	other, _, err := m.Generate(7, nil, 0)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	if other == plaintext {
+		t.Errorf("Generate() returned the same key twice")
+	}
+	keys, err := m.List(7)
+	if err != nil {
+		t.Fatalf("List() err = %s; want nil", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("len(List()) = %d; want %d", len(keys), 2)
+	}
+}
+
+func TestManager_Authenticate(t *testing.T) {
+	m := &apikey.Manager{Store: &apikey.MemStore{}}
+	valid, validKey, err := m.Generate(1, []string{"admin"}, 0)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	expired, _, err := m.Generate(1, nil, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	revoked, revokedKey, err := m.Generate(1, nil, 0)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	if err := m.Revoke(revokedKey.ID); err != nil {
+		t.Fatalf("Revoke() err = %s; want nil", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	tests := map[string]struct {
+		key  string
+		want error
+	}{
+		"valid":         {valid, nil},
+		"empty":         {"", apikey.ErrNotFound},
+		"malformed":     {"not-a-key", apikey.ErrNotFound},
+		"unknown ID":    {"abc" + valid, apikey.ErrNotFound},
+		"wrong secret":  {validKey.ID + ".wrong", apikey.ErrNotFound},
+		"expired":       {expired, apikey.ErrExpired},
+		"revoked":       {revoked, apikey.ErrRevoked},
+		"revoked twice": {revoked, apikey.ErrRevoked},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := m.Authenticate(tc.key)
+			if err != tc.want {
+				t.Errorf("Authenticate() err = %v; want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestManager_Authenticate_lastUsed(t *testing.T) {
+	m := &apikey.Manager{Store: &apikey.MemStore{}}
+	plaintext, k, err := m.Generate(1, nil, 0)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	if !k.LastUsedAt.IsZero() {
+		t.Errorf("LastUsedAt = %v before use; want zero", k.LastUsedAt)
+	}
+	before := time.Now()
+	if _, err := m.Authenticate(plaintext); err != nil {
+		t.Fatalf("Authenticate() err = %s; want nil", err)
+	}
+	stored, err := m.Store.Get(k.ID)
+	if err != nil {
+		t.Fatalf("Get() err = %s; want nil", err)
+	}
+	if stored.LastUsedAt.Before(before) {
+		t.Errorf("LastUsedAt = %v; want at least %v", stored.LastUsedAt, before)
+	}
+}
+
+func TestKey_HasScope(t *testing.T) {
+	k := apikey.Key{Scopes: []string{"read", "admin"}}
+	for scope, want := range map[string]bool{"read": true, "admin": true, "write": false, "": false} {
+		if got := k.HasScope(scope); got != want {
+			t.Errorf("HasScope(%q) = %t; want %t", scope, got, want)
+		}
+	}
+}
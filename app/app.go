@@ -1,76 +1,286 @@
 package app
 
 import (
+	"embed"
+	"encoding/json"
 	"fmt"
+	"io/fs"
+	"log"
 	"net/http"
+	"os"
 	"sync"
-)
+	"time"
 
-const (
-	fakeToken  = "fake_session_token"
-	fakeAPIKey = "fake_api_key"
+	"github.com/joncalhoun/twg/app/apikey"
+	"github.com/joncalhoun/twg/app/authz"
+	"github.com/joncalhoun/twg/app/csrf"
+	"github.com/joncalhoun/twg/app/middleware"
+	"github.com/joncalhoun/twg/app/router"
+	"github.com/joncalhoun/twg/app/session"
+	"github.com/joncalhoun/twg/view"
 )
 
+//go:embed templates
+var templates embed.FS
+
+// ScopeAdmin is the API key scope required to access admin routes.
+const ScopeAdmin = "admin"
+
 type Server struct {
-	mux  *http.ServeMux
-	once sync.Once
+	// Sessions manages signed in users. If it is nil, sessions are kept in
+	// memory and signed with a random key, so they won't survive a restart.
+	Sessions *session.Manager
+	// InsecureCookies leaves the Secure attribute off the session cookie
+	// created when Sessions is nil, so the app works over plain HTTP
+	// while developing locally.
+	InsecureCookies bool
+	// APIKeys authenticates API requests. If it is nil, keys are kept in
+	// memory.
+	APIKeys *apikey.Manager
+	// Users stores accounts created via the signup page. If it is nil,
+	// users are kept in memory.
+	Users UserStore
+	// PasswordCost is the bcrypt cost used to hash passwords. Defaults to
+	// bcrypt.DefaultCost.
+	PasswordCost int
+
+	// MaxLoginFailures is how many failed logins are allowed for a single
+	// account or IP address within LoginFailureWindow before further
+	// attempts are refused. They default to DefaultMaxLoginFailures and
+	// DefaultLoginFailureWindow.
+	MaxLoginFailures   int
+	LoginFailureWindow time.Duration
+
+	// Policy decides which permissions each user role grants. Defaults
+	// to authz.DefaultPolicy.
+	Policy authz.Policy
+	// Audit records every request to the admin routes, including those
+	// that fail authentication or are denied. If it is nil, entries are
+	// kept in memory.
+	Audit authz.AuditLog
+
+	// Logger receives access logs and details of any panics. Defaults to a
+	// logger writing to os.Stderr.
+	Logger middleware.Logger
+
+	// TemplateDir, if set, is the path to this package's templates
+	// directory. Templates are reloaded from it on every request instead
+	// of using the copies embedded in the binary, which is useful while
+	// working on them.
+	TemplateDir string
+
+	loginLimiter *limiter
+	dummy        []byte
+	dummyOnce    sync.Once
+	views        *view.Engine
+	handler      http.Handler
+	once         sync.Once
 }
 
 func (a *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.once.Do(func() {
-		a.mux = http.NewServeMux()
-		a.mux.HandleFunc("/", a.home)
-		a.mux.HandleFunc("/login", a.login)
-		a.mux.HandleFunc("/admin", cookieAuthMw(a.admin))
-		a.mux.HandleFunc("/header-admin", headerAuthMw(a.admin))
+		if a.Sessions == nil {
+			key, err := session.GenerateKey()
+			if err != nil {
+				panic(err)
+			}
+			a.Sessions = &session.Manager{
+				Store:    &session.MemStore{},
+				Key:      key,
+				Insecure: a.InsecureCookies,
+			}
+		}
+		if a.APIKeys == nil {
+			a.APIKeys = &apikey.Manager{
+				Store: &apikey.MemStore{},
+			}
+		}
+		if a.Users == nil {
+			a.Users = &MemUserStore{}
+		}
+		a.loginLimiter = &limiter{
+			max:    a.MaxLoginFailures,
+			window: a.LoginFailureWindow,
+		}
+		if a.loginLimiter.max <= 0 {
+			a.loginLimiter.max = DefaultMaxLoginFailures
+		}
+		if a.loginLimiter.window <= 0 {
+			a.loginLimiter.window = DefaultLoginFailureWindow
+		}
+		if a.Logger == nil {
+			a.Logger = log.New(os.Stderr, "", log.LstdFlags)
+		}
+		if a.Policy == nil {
+			a.Policy = authz.DefaultPolicy
+		}
+		if a.Audit == nil {
+			a.Audit = &authz.MemAuditLog{}
+		}
+		tplFS, err := fs.Sub(templates, "templates")
+		if err != nil {
+			panic(err)
+		}
+		a.views = &view.Engine{
+			FS:        tplFS,
+			Dir:       a.TemplateDir,
+			Field:     fieldTpl,
+			CSRFField: csrf.Field,
+			ErrorLog: func(r *http.Request, err error) {
+				a.Logger.Printf("rendering %s: %v", r.URL.Path, err)
+			},
+		}
+
+		rt := router.New()
+		rt.Use(
+			middleware.RequestID,
+			middleware.AccessLog(a.Logger),
+			middleware.Recover(a.Logger),
+			middleware.Gzip,
+		)
+
+		// Routes used by browsers rely on the session cookie, so they need
+		// CSRF protection.
+		web := rt.Group("", csrf.Protect(a.Sessions))
+		web.Get("/", a.home)
+		web.Get("/signup", a.signupForm)
+		web.Post("/signup", a.signup)
+		web.Get("/login", a.loginForm)
+		web.Post("/login", a.login)
+		web.Post("/logout", a.logout)
+
+		admin := web.Group("", a.auditMw, a.cookieAuthMw)
+		admin.Group("", authz.RequirePermission(authz.PermViewAdmin)).
+			Get("/admin", a.admin)
+		admin.Group("", authz.RequirePermission(authz.PermViewAudit)).
+			Get("/admin/audit", a.auditLog)
+
+		api := rt.Group("", a.auditMw, a.apiKeyMw(ScopeAdmin))
+		api.Group("", authz.RequirePermission(authz.PermViewAdmin)).
+			Get("/header-admin", a.admin)
+
+		a.handler = rt
 	})
-	a.mux.ServeHTTP(w, r)
+	a.handler.ServeHTTP(w, r)
 }
 
 func (a *Server) home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "<h1>Welcome!</h1>")
+	a.views.Render(w, r, http.StatusOK, "home.gohtml", nil)
 }
 
-func (a *Server) login(w http.ResponseWriter, r *http.Request) {
-	cookie := http.Cookie{
-		Name:  "session",
-		Value: fakeToken,
+func (a *Server) logout(w http.ResponseWriter, r *http.Request) {
+	err := a.Sessions.Destroy(w, r)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
 	}
-	http.SetCookie(w, &cookie)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-func cookieAuthMw(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		c, err := r.Cookie("session")
-		if err != nil {
-			http.Redirect(w, r, "/", http.StatusForbidden)
+// cookieAuthMw only calls next if the request has a valid session cookie
+// for a signed in user. The session is available to next via
+// session.FromContext and the user via authz.FromContext.
+func (a *Server) cookieAuthMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := a.Sessions.Load(r)
+		if err != nil || s.UserID == 0 {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 			return
 		}
-		// The way we use tokens here is insecure so don't copy this exactly
-		// Get in touch if you have more questions about actually using
-		// secure tokens - jon@calhoun.io
-		if c.Value != fakeToken {
-			http.Redirect(w, r, "/", http.StatusForbidden)
+		user, err := a.Users.ByID(s.UserID)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 			return
 		}
-		next(w, r)
+		ctx := session.NewContext(r.Context(), s)
+		ctx = authz.NewContext(ctx, a.principal(user, authz.MethodSession, ""))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiKeyMw only calls next if the request's api-key header has a valid key
+// with the scope. Otherwise it responds with a JSON error: 401 if the key
+// is missing or can't be used, and 403 if it lacks the scope. The key is
+// available to next via apikey.FromContext and the account it belongs to
+// via authz.FromContext.
+func (a *Server) apiKeyMw(scope string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("api-key")
+			if header == "" {
+				middleware.JSONError(w, http.StatusUnauthorized, "missing API key")
+				return
+			}
+			key, err := a.APIKeys.Authenticate(header)
+			switch err {
+			case nil:
+			case apikey.ErrNotFound:
+				middleware.JSONError(w, http.StatusUnauthorized, "invalid API key")
+				return
+			case apikey.ErrExpired:
+				middleware.JSONError(w, http.StatusUnauthorized, "API key has expired")
+				return
+			case apikey.ErrRevoked:
+				middleware.JSONError(w, http.StatusUnauthorized, "API key has been revoked")
+				return
+			default:
+				middleware.JSONError(w, http.StatusInternalServerError, "something went wrong")
+				return
+			}
+			if !key.HasScope(scope) {
+				middleware.JSONError(w, http.StatusForbidden, fmt.Sprintf("API key is missing the %q scope", scope))
+				return
+			}
+			user, err := a.Users.ByID(key.AccountID)
+			switch err {
+			case nil:
+			case ErrNotFound:
+				middleware.JSONError(w, http.StatusUnauthorized, "invalid API key")
+				return
+			default:
+				middleware.JSONError(w, http.StatusInternalServerError, "something went wrong")
+				return
+			}
+			ctx := apikey.NewContext(r.Context(), key)
+			ctx = authz.NewContext(ctx, a.principal(user, authz.MethodAPIKey, key.ID))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
 	}
 }
 
-func headerAuthMw(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		key := r.Header.Get("api-key")
-		if key != fakeAPIKey {
-			http.Redirect(w, r, "/", http.StatusForbidden)
-			return
-		}
-		next(w, r)
+func (a *Server) principal(user *User, method, keyID string) *authz.Principal {
+	return &authz.Principal{
+		UserID:      user.ID,
+		Method:      method,
+		KeyID:       keyID,
+		Roles:       user.Roles,
+		Permissions: a.Policy.Permissions(user.Roles),
+	}
+}
+
+// auditMw records requests to the admin routes in a.Audit.
+func (a *Server) auditMw(next http.Handler) http.Handler {
+	requestID := func(r *http.Request) string {
+		return middleware.GetRequestID(r.Context())
+	}
+	onError := func(err error) {
+		a.Logger.Printf("audit: %v", err)
 	}
+	return authz.Audit(a.Audit, requestID, onError)(next)
 }
 
 func (a *Server) admin(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "<h1>Welcome to the admin page!</h1>")
+	a.views.Render(w, r, http.StatusOK, "admin.gohtml", nil)
+}
+
+func (a *Server) auditLog(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.Audit.Entries()
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
 }
 
 func Home(w http.ResponseWriter, r *http.Request) {
@@ -1,14 +1,26 @@
 package app_test
 
 import (
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/joncalhoun/twg/app"
+	"github.com/joncalhoun/twg/app/apikey"
+	"github.com/joncalhoun/twg/app/authz"
+	"github.com/joncalhoun/twg/app/session"
+	"github.com/joncalhoun/twg/gen"
+	"github.com/joncalhoun/twg/htmltest"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -43,38 +55,124 @@ func TestApp_v1(t *testing.T) {
 	if err != nil {
 		t.Errorf("ioutil.ReadAll() err = %s; want nil", err)
 	}
-	got := string(body)
-	want := "<h1>Welcome!</h1>"
-	if got != want {
-		t.Errorf("GET / = %s; want %s", got, want)
-	}
+	htmltest.Parse(t, string(body)).TextEquals("h1", "Welcome!")
 }
 
-func signedInClient(t *testing.T, baseURL string) *http.Client {
+func newClient(t *testing.T) *http.Client {
 	// Our cookiejar will keep and set cookies for us between requests.
 	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	if err != nil {
 		t.Fatalf("cookejar.New() err = %s; want nil", err)
 	}
-	client := &http.Client{
+	return &http.Client{
 		Jar: jar,
 	}
+}
 
-	// Our client has a cookie jar, but it has no session cookie. By logging
-	// in we can ensure that it gets set.
-	loginURL := baseURL + "/login"
-	req, err := http.NewRequest(http.MethodPost, loginURL, nil)
+// formToken returns the CSRF token from the first form in body.
+func formToken(t *testing.T, body string) string {
+	t.Helper()
+	forms := htmltest.Parse(t, body).Forms()
+	if len(forms) == 0 {
+		t.Fatalf("body = %s; want a form", body)
+	}
+	field, ok := forms[0].Field("csrf_token")
+	if !ok {
+		t.Fatalf("body = %s; want a form with a CSRF token", body)
+	}
+	return field.Value
+}
+
+// csrfToken returns the CSRF token from the form on the page at url. The
+// client must have a cookie jar so that the session the token belongs to
+// is kept.
+func csrfToken(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s err = %s; want nil", url, err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+	}
+	return formToken(t, string(body))
+}
+
+// postForm submits the form at url along with the CSRF token from the page
+// at url.
+func postForm(t *testing.T, client *http.Client, url string, values url.Values) *http.Response {
+	t.Helper()
+	values.Set("csrf_token", csrfToken(t, client, url))
+	res, err := client.PostForm(url, values)
 	if err != nil {
-		t.Fatalf("NewRequest() err = %s; want nil", err)
+		t.Fatalf("POST %s err = %s; want nil", url, err)
 	}
-	_, err = client.Do(req)
+	return res
+}
+
+// signUp creates a new account and returns its email address and password.
+func signUp(t *testing.T, baseURL string) (string, string) {
+	email, password := gen.Email(), "correct horse battery staple"
+	res := postForm(t, newClient(t), baseURL+"/signup", url.Values{
+		"email":    {email},
+		"password": {password},
+	})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST /signup code = %d; want %d", res.StatusCode, http.StatusOK)
+	}
+	return email, password
+}
+
+// createUser adds a user with the roles directly to the store, since the
+// signup page only creates members.
+func createUser(t *testing.T, users app.UserStore, email, password string, roles ...authz.Role) *app.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
 	if err != nil {
-		t.Fatalf("POST /login err = %s; want nil", err)
+		t.Fatalf("GenerateFromPassword() err = %s; want nil", err)
+	}
+	user := &app.User{
+		Email:        email,
+		PasswordHash: string(hash),
+		Roles:        roles,
+	}
+	if err := users.Create(user); err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
 	}
-	t.Logf("Cookies: %v", client.Jar.Cookies(req.URL))
+	return user
+}
+
+// logIn returns a client with a session cookie for the account.
+func logIn(t *testing.T, baseURL, email, password string) *http.Client {
+	client := newClient(t)
+
+	// Our client has a cookie jar, but it has no session cookie. By logging
+	// in we can ensure that it gets set. Logging in requires a CSRF token,
+	// which postForm gets from the login page first.
+	loginURL := baseURL + "/login"
+	res := postForm(t, client, loginURL, url.Values{
+		"email":    {email},
+		"password": {password},
+	})
+	res.Body.Close()
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatalf("url.Parse() err = %s; want nil", err)
+	}
+	t.Logf("Cookies: %v", client.Jar.Cookies(u))
 	return client
 }
 
+// signedInClient signs up a new member and returns a client logged in as
+// them.
+func signedInClient(t *testing.T, baseURL string) *http.Client {
+	email, password := signUp(t, baseURL)
+	return logIn(t, baseURL, email, password)
+}
+
 type headerClient struct {
 	headers map[string]string
 }
@@ -91,25 +189,61 @@ func (hc headerClient) Get(url string) (*http.Response, error) {
 	return client.Do(req)
 }
 
-func signedInRequest(t *testing.T, method, target string, body io.Reader) *http.Request {
+func testSessions() *session.Manager {
+	return &session.Manager{
+		Store: &session.MemStore{},
+		Key:   []byte("test-key-that-is-not-very-secret"),
+	}
+}
+
+// signedInRequest returns a request with a session cookie for the user
+// with ID 1.
+func signedInRequest(t *testing.T, sm *session.Manager, method, target string, body io.Reader) *http.Request {
+	return signedInRequestAs(t, sm, 1, method, target, body)
+}
+
+func signedInRequestAs(t *testing.T, sm *session.Manager, userID int, method, target string, body io.Reader) *http.Request {
 	req, err := http.NewRequest(method, target, body)
 	if err != nil {
 		t.Fatalf("http.NewRequest() err = %s; want nil", err)
 	}
-	req.AddCookie(&http.Cookie{
-		Name:  "session",
-		Value: "fake_session_token",
-	})
+	s, err := sm.New(userID)
+	if err != nil {
+		t.Fatalf("Sessions.New() err = %s; want nil", err)
+	}
+	cookie, err := sm.Cookie(s)
+	if err != nil {
+		t.Fatalf("Sessions.Cookie() err = %s; want nil", err)
+	}
+	req.AddCookie(cookie)
 	return req
 }
 
+const (
+	adminEmail    = "admin@example.com"
+	adminPassword = "correct horse battery staple"
+)
+
+// testUsers returns a store whose first user, with ID 1, is an admin.
+func testUsers(t *testing.T) *app.MemUserStore {
+	users := &app.MemUserStore{}
+	createUser(t, users, adminEmail, adminPassword, authz.RoleAdmin)
+	return users
+}
+
 func TestApp_v2(t *testing.T) {
-	server := httptest.NewServer(&app.Server{})
+	sm := testSessions()
+	km := &apikey.Manager{Store: &apikey.MemStore{}}
+	adminKey, _, err := km.Generate(1, []string{app.ScopeAdmin}, 0)
+	if err != nil {
+		t.Fatalf("Generate() err = %s; want nil", err)
+	}
+	server := httptest.NewServer(&app.Server{Sessions: sm, APIKeys: km, Users: testUsers(t), PasswordCost: bcrypt.MinCost})
 	defer server.Close()
 
 	t.Run("custom built request", func(t *testing.T) {
 		t.Log(server.URL)
-		req := signedInRequest(t, http.MethodGet, server.URL+"/admin", nil)
+		req := signedInRequest(t, sm, http.MethodGet, server.URL+"/admin", nil)
 		var client http.Client
 		resp, err := client.Do(req)
 		if err != nil {
@@ -120,15 +254,11 @@ func TestApp_v2(t *testing.T) {
 		if err != nil {
 			t.Errorf("ioutil.ReadAll() err = %s; want nil", err)
 		}
-		got := string(body)
-		want := "<h1>Welcome to the admin page!</h1>"
-		if got != want {
-			t.Errorf("GET /admin = %s; want %s", got, want)
-		}
+		htmltest.Parse(t, string(body)).TextEquals("h1", "Welcome to the admin page!")
 	})
 
 	t.Run("cookie based auth", func(t *testing.T) {
-		client := signedInClient(t, server.URL)
+		client := logIn(t, server.URL, adminEmail, adminPassword)
 		res, err := client.Get(server.URL + "/admin")
 		if err != nil {
 			t.Errorf("GET /admin err = %s; want nil", err)
@@ -141,14 +271,14 @@ func TestApp_v2(t *testing.T) {
 		if err != nil {
 			t.Errorf("GET /header-admin err = %s; want nil", err)
 		}
-		if res.StatusCode != 403 {
-			t.Errorf("GET /header-admin code = %d; want %d", res.StatusCode, 403)
+		if res.StatusCode != 401 {
+			t.Errorf("GET /header-admin code = %d; want %d", res.StatusCode, 401)
 		}
 	})
 
 	t.Run("header based auth", func(t *testing.T) {
 		client := headerClient{
-			headers: map[string]string{"api-key": "fake_api_key"},
+			headers: map[string]string{"api-key": adminKey},
 		}
 		res, err := client.Get(server.URL + "/admin")
 		if err != nil {
@@ -157,6 +287,9 @@ func TestApp_v2(t *testing.T) {
 		if res.StatusCode != 403 {
 			t.Errorf("GET /admin code = %d; want %d", res.StatusCode, 403)
 		}
+		if loc := res.Header.Get("Location"); loc != "" {
+			t.Errorf("GET /admin Location = %q; want none", loc)
+		}
 		res, err = client.Get(server.URL + "/header-admin")
 		if err != nil {
 			t.Errorf("GET /header-admin err = %s; want nil", err)
@@ -166,3 +299,325 @@ func TestApp_v2(t *testing.T) {
 		}
 	})
 }
+
+func TestApp_sessions(t *testing.T) {
+	server := httptest.NewServer(&app.Server{Users: testUsers(t), PasswordCost: bcrypt.MinCost})
+	defer server.Close()
+
+	t.Run("logout", func(t *testing.T) {
+		client := logIn(t, server.URL, adminEmail, adminPassword)
+		res, err := client.Get(server.URL + "/admin")
+		if err != nil {
+			t.Fatalf("GET /admin err = %s; want nil", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 200 {
+			t.Fatalf("GET /admin before logout code = %d; want %d", res.StatusCode, 200)
+		}
+		// Any page with a form has the session's CSRF token.
+		token := csrfToken(t, client, server.URL+"/login")
+		res, err = client.PostForm(server.URL+"/logout", url.Values{"csrf_token": {token}})
+		if err != nil {
+			t.Fatalf("POST /logout err = %s; want nil", err)
+		}
+		res.Body.Close()
+		res, err = client.Get(server.URL + "/admin")
+		if err != nil {
+			t.Fatalf("GET /admin err = %s; want nil", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 403 {
+			t.Errorf("GET /admin after logout code = %d; want %d", res.StatusCode, 403)
+		}
+	})
+
+	t.Run("tampered cookie", func(t *testing.T) {
+		client := logIn(t, server.URL, adminEmail, adminPassword)
+		u, err := url.Parse(server.URL)
+		if err != nil {
+			t.Fatalf("url.Parse() err = %s; want nil", err)
+		}
+		cookies := client.Jar.Cookies(u)
+		if len(cookies) != 1 {
+			t.Fatalf("len(cookies) = %d; want 1", len(cookies))
+		}
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/admin", nil)
+		if err != nil {
+			t.Fatalf("NewRequest() err = %s; want nil", err)
+		}
+		req.AddCookie(&http.Cookie{
+			Name:  cookies[0].Name,
+			Value: "x" + cookies[0].Value,
+		})
+		var plain http.Client
+		res, err := plain.Do(req)
+		if err != nil {
+			t.Fatalf("GET /admin err = %s; want nil", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 403 {
+			t.Errorf("GET /admin with a tampered cookie code = %d; want %d", res.StatusCode, 403)
+		}
+	})
+}
+
+func TestApp_apiKeys(t *testing.T) {
+	km := &apikey.Manager{Store: &apikey.MemStore{}}
+	generate := func(scopes []string, ttl time.Duration) (string, *apikey.Key) {
+		plaintext, k, err := km.Generate(1, scopes, ttl)
+		if err != nil {
+			t.Fatalf("Generate() err = %s; want nil", err)
+		}
+		return plaintext, k
+	}
+	admin, adminKey := generate([]string{app.ScopeAdmin}, 0)
+	readOnly, _ := generate([]string{"read"}, 0)
+	expired, _ := generate([]string{app.ScopeAdmin}, time.Nanosecond)
+	revoked, revokedKey := generate([]string{app.ScopeAdmin}, 0)
+	if err := km.Revoke(revokedKey.ID); err != nil {
+		t.Fatalf("Revoke() err = %s; want nil", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	server := httptest.NewServer(&app.Server{APIKeys: km, Users: testUsers(t)})
+	defer server.Close()
+
+	tests := map[string]struct {
+		key       string
+		wantCode  int
+		wantError string
+	}{
+		"valid":         {admin, 200, ""},
+		"missing":       {"", 401, "missing API key"},
+		"invalid":       {"fake_api_key", 401, "invalid API key"},
+		"expired":       {expired, 401, "API key has expired"},
+		"revoked":       {revoked, 401, "API key has been revoked"},
+		"missing scope": {readOnly, 403, `API key is missing the "admin" scope`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := headerClient{
+				headers: map[string]string{"api-key": tc.key},
+			}
+			res, err := client.Get(server.URL + "/header-admin")
+			if err != nil {
+				t.Fatalf("GET /header-admin err = %s; want nil", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("GET /header-admin code = %d; want %d", res.StatusCode, tc.wantCode)
+			}
+			if tc.wantError == "" {
+				return
+			}
+			if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q; want %q", ct, "application/json")
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Decode() err = %s; want nil", err)
+			}
+			if body.Error != tc.wantError {
+				t.Errorf("error = %q; want %q", body.Error, tc.wantError)
+			}
+		})
+	}
+
+	stored, err := km.Store.Get(adminKey.ID)
+	if err != nil {
+		t.Fatalf("Get() err = %s; want nil", err)
+	}
+	if stored.LastUsedAt.IsZero() {
+		t.Errorf("LastUsedAt is zero after use; want it to be set")
+	}
+}
+
+func TestApp_routing(t *testing.T) {
+	server := &app.Server{}
+	tests := []struct {
+		method    string
+		path      string
+		wantCode  int
+		wantAllow string
+	}{
+		{http.MethodGet, "/", 200, ""},
+		{http.MethodHead, "/login", 200, ""},
+		{http.MethodGet, "/missing", 404, ""},
+		{http.MethodGet, "/logout", 405, "POST"},
+		{http.MethodDelete, "/login", 405, "GET, HEAD, POST"},
+		{http.MethodPost, "/admin", 405, "GET, HEAD"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+			if w.Code != tc.wantCode {
+				t.Errorf("code = %d; want %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Allow"); got != tc.wantAllow {
+				t.Errorf("Allow = %q; want %q", got, tc.wantAllow)
+			}
+			if w.Header().Get("X-Request-ID") == "" {
+				t.Errorf("X-Request-ID header is missing")
+			}
+		})
+	}
+}
+
+func TestApp_gzip(t *testing.T) {
+	server := &app.Server{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q; want %q", got, "gzip")
+	}
+}
+
+func TestApp_authz(t *testing.T) {
+	sm := testSessions()
+	km := &apikey.Manager{Store: &apikey.MemStore{}}
+	users := &app.MemUserStore{}
+	member := createUser(t, users, "member@example.com", "password", authz.RoleMember)
+	auditor := createUser(t, users, "auditor@example.com", "password", authz.RoleAuditor)
+	admin := createUser(t, users, "admin@example.com", "password", authz.RoleAdmin)
+	audit := &authz.MemAuditLog{}
+	server := httptest.NewServer(&app.Server{
+		Sessions: sm,
+		APIKeys:  km,
+		Users:    users,
+		Audit:    audit,
+	})
+	defer server.Close()
+
+	keys := make(map[int]string)
+	for _, id := range []int{member.ID, auditor.ID, admin.ID, 99} {
+		plaintext, _, err := km.Generate(id, []string{app.ScopeAdmin}, 0)
+		if err != nil {
+			t.Fatalf("Generate() err = %s; want nil", err)
+		}
+		keys[id] = plaintext
+	}
+
+	cookie := func(userID int, path string) *http.Request {
+		return signedInRequestAs(t, sm, userID, http.MethodGet, server.URL+path, nil)
+	}
+	header := func(userID int, path string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest() err = %s; want nil", err)
+		}
+		req.Header.Set("api-key", keys[userID])
+		return req
+	}
+
+	tests := map[string]struct {
+		req      func(userID int, path string) *http.Request
+		userID   int
+		path     string
+		wantCode int
+		// wantMethod is empty for requests that fail authentication. They
+		// are still audited, but without a user.
+		wantMethod string
+	}{
+		"cookie member admin":    {cookie, member.ID, "/admin", 403, authz.MethodSession},
+		"cookie member audit":    {cookie, member.ID, "/admin/audit", 403, authz.MethodSession},
+		"cookie auditor admin":   {cookie, auditor.ID, "/admin", 403, authz.MethodSession},
+		"cookie auditor audit":   {cookie, auditor.ID, "/admin/audit", 200, authz.MethodSession},
+		"cookie admin admin":     {cookie, admin.ID, "/admin", 200, authz.MethodSession},
+		"cookie admin audit":     {cookie, admin.ID, "/admin/audit", 200, authz.MethodSession},
+		"cookie deleted account": {cookie, 99, "/admin", 403, ""},
+		"cookie on api route":    {cookie, admin.ID, "/header-admin", 401, ""},
+		"header member":          {header, member.ID, "/header-admin", 403, authz.MethodAPIKey},
+		"header auditor":         {header, auditor.ID, "/header-admin", 403, authz.MethodAPIKey},
+		"header admin":           {header, admin.ID, "/header-admin", 200, authz.MethodAPIKey},
+		"header deleted account": {header, 99, "/header-admin", 401, ""},
+		"header on web route":    {header, admin.ID, "/admin", 403, ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			before, _ := audit.Entries()
+			var client http.Client
+			res, err := client.Do(tc.req(tc.userID, tc.path))
+			if err != nil {
+				t.Fatalf("GET %s err = %s; want nil", tc.path, err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("GET %s code = %d; want %d", tc.path, res.StatusCode, tc.wantCode)
+			}
+
+			after, _ := audit.Entries()
+			if len(after) != len(before)+1 {
+				t.Fatalf("audit entries = %d; want %d", len(after), len(before)+1)
+			}
+			got := after[len(after)-1]
+			wantUser := tc.userID
+			if tc.wantMethod == "" {
+				wantUser = 0
+			}
+			if got.UserID != wantUser || got.Method != tc.wantMethod || got.Path != tc.path || got.Status != tc.wantCode {
+				t.Errorf("audit entry = %+v; want user %d via %q to %s with status %d",
+					got, wantUser, tc.wantMethod, tc.path, tc.wantCode)
+			}
+			if got.RequestID == "" || got.RequestID != res.Header.Get("X-Request-ID") {
+				t.Errorf("audit RequestID = %q; want %q", got.RequestID, res.Header.Get("X-Request-ID"))
+			}
+		})
+	}
+
+	t.Run("audit log page", func(t *testing.T) {
+		var client http.Client
+		res, err := client.Do(cookie(admin.ID, "/admin/audit"))
+		if err != nil {
+			t.Fatalf("GET /admin/audit err = %s; want nil", err)
+		}
+		defer res.Body.Close()
+		var entries []authz.AuditEntry
+		if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+			t.Fatalf("Decode() err = %s; want nil", err)
+		}
+		want, _ := audit.Entries()
+		// The page's own request is recorded after it is served.
+		if len(entries) != len(want)-1 {
+			t.Errorf("len(entries) = %d; want %d", len(entries), len(want)-1)
+		}
+	})
+}
+
+func TestApp_templateDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS("templates")); err != nil {
+		t.Fatalf("CopyFS() err = %s; want nil", err)
+	}
+	server := httptest.NewServer(&app.Server{TemplateDir: dir})
+	defer server.Close()
+
+	get := func() string {
+		t.Helper()
+		res, err := http.Get(server.URL + "/login")
+		if err != nil {
+			t.Fatalf("GET /login err = %s; want nil", err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+		}
+		return string(body)
+	}
+	const marker = "<p>Edited while running</p>"
+	if body := get(); strings.Contains(body, marker) {
+		t.Fatalf("GET /login = %s; want it not to contain %q yet", body, marker)
+	}
+	contents := "{{define \"content\"}}" + marker + "{{end}}"
+	if err := os.WriteFile(filepath.Join(dir, "auth.gohtml"), []byte(contents), 0644); err != nil {
+		t.Fatalf("WriteFile() err = %s; want nil", err)
+	}
+	if body := get(); !strings.Contains(body, marker) {
+		t.Errorf("GET /login = %s; want it to contain %q", body, marker)
+	}
+}
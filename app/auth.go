@@ -0,0 +1,278 @@
+package app
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joncalhoun/twg/app/authz"
+	"github.com/joncalhoun/twg/form"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// DefaultMaxLoginFailures is used when Server.MaxLoginFailures is zero.
+	DefaultMaxLoginFailures = 5
+	// DefaultLoginFailureWindow is used when Server.LoginFailureWindow is
+	// zero.
+	DefaultLoginFailureWindow = 15 * time.Minute
+
+	minPasswordLen = 8
+)
+
+var fieldTpl = template.Must(template.New("field").Parse(`
+	<label>{{.Label}}</label>
+	<input type="{{.Type}}" name="{{.Name}}" placeholder="{{.Placeholder}}"{{with .Value}} value="{{.}}"{{end}}>
+	{{range .Errors}}<p class="error">{{.}}</p>{{end}}`))
+
+// authForm is used for both the signup and login forms.
+type authForm struct {
+	Email    string `form:"name=email;label=Email Address;type=email;placeholder=you@example.com"`
+	Password string `form:"name=password;label=Password;type=password;placeholder=Password"`
+}
+
+func parseAuthForm(r *http.Request) authForm {
+	return authForm{
+		Email:    normalizeEmail(r.PostFormValue("email")),
+		Password: r.PostFormValue("password"),
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// renderForm renders a page with the form. The password is never sent
+// back to the browser.
+func (a *Server) renderForm(w http.ResponseWriter, r *http.Request, status int, title, action string, f authForm, errs ...form.FieldError) {
+	f.Password = ""
+	a.views.Render(w, r, status, "auth.gohtml", struct {
+		Title  string
+		Action string
+		Form   authForm
+		Errors []form.FieldError
+	}{title, action, f, errs})
+}
+
+func (a *Server) signupForm(w http.ResponseWriter, r *http.Request) {
+	a.renderForm(w, r, http.StatusOK, "Sign up", "/signup", authForm{})
+}
+
+func (a *Server) signup(w http.ResponseWriter, r *http.Request) {
+	f := parseAuthForm(r)
+	var errs []form.FieldError
+	if !strings.Contains(f.Email, "@") {
+		errs = append(errs, form.FieldError{Field: "email", Error: "Please provide a valid email address"})
+	}
+	if len(f.Password) < minPasswordLen {
+		errs = append(errs, form.FieldError{Field: "password", Error: "Password must be at least " + strconv.Itoa(minPasswordLen) + " characters long"})
+	}
+	if len(errs) > 0 {
+		a.renderForm(w, r, http.StatusUnprocessableEntity, "Sign up", "/signup", f, errs...)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(f.Password), a.passwordCost())
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	user := User{
+		Email:        f.Email,
+		PasswordHash: string(hash),
+		Roles:        []authz.Role{authz.RoleMember},
+	}
+	err = a.Users.Create(&user)
+	if err == ErrEmailTaken {
+		a.renderForm(w, r, http.StatusUnprocessableEntity, "Sign up", "/signup", f,
+			form.FieldError{Field: "email", Error: "That email address is already taken"})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	a.startSession(w, r, user.ID)
+}
+
+func (a *Server) loginForm(w http.ResponseWriter, r *http.Request) {
+	a.renderForm(w, r, http.StatusOK, "Log in", "/login", authForm{})
+}
+
+func (a *Server) login(w http.ResponseWriter, r *http.Request) {
+	f := parseAuthForm(r)
+	accountKey := "account:" + f.Email
+	ipKey := "ip:" + clientIP(r)
+	// The attempt counts as a failure until the password is known to be
+	// right, so parallel requests can't all get past the limit while their
+	// passwords are being checked.
+	now := time.Now()
+	if wait, ok := a.loginLimiter.reserve(now, accountKey, ipKey); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		a.renderForm(w, r, http.StatusTooManyRequests, "Log in", "/login", f,
+			form.FieldError{Field: "email", Error: "Too many failed attempts. Please try again later"})
+		return
+	}
+
+	user, err := a.Users.ByEmail(f.Email)
+	if err != nil && err != ErrNotFound {
+		a.loginLimiter.release(now, accountKey, ipKey)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	// Unknown emails are checked against a dummy hash so that they take as
+	// long as a wrong password and response times don't reveal which
+	// emails have accounts.
+	var hash []byte
+	if err == nil {
+		hash = []byte(user.PasswordHash)
+	} else {
+		hash = a.dummyHash()
+	}
+	match := bcrypt.CompareHashAndPassword(hash, []byte(f.Password)) == nil
+	if err == ErrNotFound || !match {
+		a.renderForm(w, r, http.StatusUnauthorized, "Log in", "/login", f,
+			form.FieldError{Field: "email", Error: "Invalid email address or password"})
+		return
+	}
+	// Only the account is cleared. Clearing the IP too would let someone
+	// with an account of their own reset the IP's count between guesses at
+	// other accounts.
+	a.loginLimiter.reset(accountKey)
+	a.loginLimiter.release(now, ipKey)
+	a.startSession(w, r, user.ID)
+}
+
+func (a *Server) passwordCost() int {
+	if a.PasswordCost > 0 {
+		return a.PasswordCost
+	}
+	return bcrypt.DefaultCost
+}
+
+// dummyHash returns the hash of a password nobody knows, made with the same
+// cost as real ones.
+func (a *Server) dummyHash() []byte {
+	a.dummyOnce.Do(func() {
+		// If this fails the hash is nil, which never matches a password.
+		a.dummy, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), a.passwordCost())
+	})
+	return a.dummy
+}
+
+func (a *Server) startSession(w http.ResponseWriter, r *http.Request, userID int) {
+	_, err := a.Sessions.Start(w, r, userID)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// clientIP returns the IP address of the client that sent r.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limiter blocks a key once it has failed max times within window.
+type limiter struct {
+	max    int
+	window time.Duration
+
+	mu        sync.Mutex
+	failures  map[string][]time.Time
+	lastPrune time.Time
+}
+
+// reserve reports whether every key may be attempted at now and, if so,
+// records a failure at now for each of them. Successful attempts give the
+// failure back with release. If any key is blocked nothing is recorded,
+// and reserve returns how long until they are all allowed.
+func (l *limiter) reserve(now time.Time, keys ...string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failures == nil {
+		l.failures = make(map[string][]time.Time)
+	}
+	if now.Sub(l.lastPrune) >= l.window {
+		l.prune(now)
+	}
+	var wait time.Duration
+	for _, key := range keys {
+		recent := l.recent(key, now)
+		if len(recent) < l.max {
+			continue
+		}
+		if d := recent[len(recent)-l.max].Add(l.window).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, key := range keys {
+		l.failures[key] = append(l.failures[key], now)
+	}
+	return 0, true
+}
+
+// release removes a failure recorded by reserve at now from each key.
+func (l *limiter) release(now time.Time, keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		failures := l.failures[key]
+		for i := len(failures) - 1; i >= 0; i-- {
+			if failures[i].Equal(now) {
+				failures = append(failures[:i], failures[i+1:]...)
+				break
+			}
+		}
+		if len(failures) == 0 {
+			delete(l.failures, key)
+		} else {
+			l.failures[key] = failures
+		}
+	}
+}
+
+func (l *limiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// prune drops the failures of every key that is outside the window, so
+// keys that are never tried again don't stay in memory. It must be called
+// with l.mu held.
+func (l *limiter) prune(now time.Time) {
+	for key := range l.failures {
+		l.recent(key, now)
+	}
+	l.lastPrune = now
+}
+
+// recent drops failures older than the window and returns the rest. It
+// must be called with l.mu held.
+func (l *limiter) recent(key string, now time.Time) []time.Time {
+	failures := l.failures[key]
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) >= l.window {
+		i++
+	}
+	failures = failures[i:]
+	if len(failures) == 0 {
+		delete(l.failures, key)
+		return nil
+	}
+	l.failures[key] = failures
+	return failures
+}
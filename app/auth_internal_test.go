@@ -0,0 +1,63 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_prune(t *testing.T) {
+	l := &limiter{max: 3, window: time.Minute}
+	old := time.Now().Add(-time.Hour)
+	l.failures = map[string][]time.Time{
+		"ip:10.0.0.1": {old},
+		"ip:10.0.0.2": {old, old},
+	}
+	l.reserve(time.Now(), "ip:10.0.0.3")
+	if len(l.failures) != 1 {
+		t.Errorf("failures after reserve() = %v; want only ip:10.0.0.3", l.failures)
+	}
+}
+
+func TestLimiter_reserve_concurrent(t *testing.T) {
+	const attempts = 50
+	l := &limiter{max: 3, window: time.Minute}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, ok := l.reserve(time.Now(), "account:jon@calhoun.io", "ip:10.0.0.1"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if allowed != l.max {
+		t.Errorf("reserve() allowed %d of %d parallel attempts; want %d", allowed, attempts, l.max)
+	}
+}
+
+func TestLimiter_release(t *testing.T) {
+	l := &limiter{max: 1, window: time.Minute}
+	now := time.Now()
+	if _, ok := l.reserve(now, "ip:10.0.0.1"); !ok {
+		t.Fatalf("reserve() ok = false; want true")
+	}
+	if _, ok := l.reserve(now.Add(time.Second), "ip:10.0.0.1"); ok {
+		t.Fatalf("reserve() over the limit ok = true; want false")
+	}
+	l.release(now, "ip:10.0.0.1")
+	if _, ok := l.reserve(now.Add(time.Second), "ip:10.0.0.1"); !ok {
+		t.Errorf("reserve() after release() ok = false; want true")
+	}
+}
@@ -0,0 +1,303 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/twg/app"
+	"github.com/joncalhoun/twg/htmltest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// submit GETs the form at path and then POSTs values to it along with the
+// session cookie and CSRF token from the form, as a browser would. Both
+// requests are made from remoteAddr if it isn't empty.
+func submit(t *testing.T, h http.Handler, path, remoteAddr string, values url.Values) (*http.Response, string) {
+	t.Helper()
+	get := httptest.NewRequest(http.MethodGet, path, nil)
+	if remoteAddr != "" {
+		get.RemoteAddr = remoteAddr
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, get)
+	values.Set("csrf_token", formToken(t, w.Body.String()))
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if remoteAddr != "" {
+		r.RemoteAddr = remoteAddr
+	}
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	res := w.Result()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+	}
+	return res, string(body)
+}
+
+func credentials(email, password string) url.Values {
+	return url.Values{
+		"email":    {email},
+		"password": {password},
+	}
+}
+
+func TestServer_signup(t *testing.T) {
+	users := &app.MemUserStore{}
+	server := &app.Server{Users: users, PasswordCost: bcrypt.MinCost}
+
+	res, _ := submit(t, server, "/signup", "", credentials(" Jon@Calhoun.io ", "correct horse"))
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("POST /signup code = %d; want %d", res.StatusCode, http.StatusFound)
+	}
+	if len(res.Cookies()) == 0 {
+		t.Errorf("POST /signup didn't set a session cookie")
+	}
+	user, err := users.ByEmail("jon@calhoun.io")
+	if err != nil {
+		t.Fatalf("ByEmail() err = %s; want nil", err)
+	}
+	if user.PasswordHash == "correct horse" {
+		t.Errorf("PasswordHash is the plaintext password")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("correct horse")); err != nil {
+		t.Errorf("CompareHashAndPassword() err = %s; want nil", err)
+	}
+}
+
+func TestServer_signup_invalid(t *testing.T) {
+	server := &app.Server{PasswordCost: bcrypt.MinCost}
+	submit(t, server, "/signup", "", credentials("taken@example.com", "correct horse"))
+
+	tests := map[string]struct {
+		email, password string
+		wantErrors      []string
+	}{
+		"invalid email":  {"jon", "correct horse", []string{"Please provide a valid email address"}},
+		"short password": {"jon@calhoun.io", "short", []string{"Password must be at least 8 characters long"}},
+		"both": {"", "", []string{
+			"Please provide a valid email address",
+			"Password must be at least 8 characters long",
+		}},
+		"email taken": {"taken@example.com", "correct horse", []string{"That email address is already taken"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, body := submit(t, server, "/signup", "", credentials(tc.email, tc.password))
+			if res.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("POST /signup code = %d; want %d", res.StatusCode, http.StatusUnprocessableEntity)
+			}
+			doc := htmltest.Parse(t, body)
+			doc.TextEquals("form p.error", tc.wantErrors...)
+			forms := doc.Forms()
+			if len(forms) != 1 {
+				t.Fatalf("POST /signup has %d forms; want 1", len(forms))
+			}
+			wantValues := map[string]string{
+				"email":    tc.email,
+				"password": "",
+			}
+			for name, want := range wantValues {
+				f, ok := forms[0].Field(name)
+				if !ok {
+					t.Errorf("POST /signup form is missing the %s field", name)
+				} else if f.Value != want {
+					t.Errorf("POST /signup %s field value = %q; want %q", name, f.Value, want)
+				}
+			}
+			if tc.password != "" && strings.Contains(body, tc.password) {
+				t.Errorf("POST /signup body contains the password")
+			}
+		})
+	}
+}
+
+func TestServer_login(t *testing.T) {
+	server := &app.Server{PasswordCost: bcrypt.MinCost}
+	submit(t, server, "/signup", "", credentials("jon@calhoun.io", "correct horse"))
+
+	tests := map[string]struct {
+		email, password string
+		wantCode        int
+	}{
+		"valid":              {"jon@calhoun.io", "correct horse", http.StatusFound},
+		"email case":         {"JON@calhoun.io", "correct horse", http.StatusFound},
+		"wrong password":     {"jon@calhoun.io", "wrong password", http.StatusUnauthorized},
+		"unknown email":      {"bob@example.com", "correct horse", http.StatusUnauthorized},
+		"missing password":   {"jon@calhoun.io", "", http.StatusUnauthorized},
+		"missing everything": {"", "", http.StatusUnauthorized},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, body := submit(t, server, "/login", "", credentials(tc.email, tc.password))
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("POST /login code = %d; want %d", res.StatusCode, tc.wantCode)
+			}
+			if tc.wantCode == http.StatusFound {
+				if len(res.Cookies()) == 0 {
+					t.Errorf("POST /login didn't set a session cookie")
+				}
+				return
+			}
+			if len(res.Cookies()) != 0 {
+				t.Errorf("POST /login set cookies %v; want none", res.Cookies())
+			}
+			htmltest.Parse(t, body).TextEquals("form p.error", "Invalid email address or password")
+		})
+	}
+}
+
+func TestServer_login_form(t *testing.T) {
+	server := &app.Server{PasswordCost: bcrypt.MinCost}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET /login code = %d; want %d", res.StatusCode, http.StatusOK)
+	}
+	doc := htmltest.Parse(t, w.Body.String())
+	doc.CountIs("form", 1).
+		HasElement(`form[action="/login"][method=POST] input[name=email][type=email]`).
+		HasElement(`form[action="/login"] input[name=password][type=password]`).
+		TextEquals("form button[type=submit]", "Log in").
+		CountIs("p.error", 0)
+}
+
+func TestServer_login_rateLimit(t *testing.T) {
+	const (
+		ip      = "10.0.0.1:1234"
+		otherIP = "10.0.0.2:1234"
+	)
+	tests := map[string]struct {
+		// failures are made from ip for jon@calhoun.io
+		failures   int
+		email      string
+		remoteAddr string
+		wantCode   int
+	}{
+		"under limit":                {2, "jon@calhoun.io", ip, http.StatusFound},
+		"success after limit":        {3, "jon@calhoun.io", ip, http.StatusTooManyRequests},
+		"same account, other IP":     {3, "jon@calhoun.io", otherIP, http.StatusTooManyRequests},
+		"other account, same IP":     {3, "bob@example.com", ip, http.StatusTooManyRequests},
+		"other account and other IP": {3, "bob@example.com", otherIP, http.StatusFound},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := &app.Server{MaxLoginFailures: 3, PasswordCost: bcrypt.MinCost}
+			for _, email := range []string{"jon@calhoun.io", "bob@example.com"} {
+				submit(t, server, "/signup", "", credentials(email, "correct horse"))
+			}
+			for i := 0; i < tc.failures; i++ {
+				submit(t, server, "/login", ip, credentials("jon@calhoun.io", "wrong password"))
+			}
+			res, body := submit(t, server, "/login", tc.remoteAddr, credentials(tc.email, "correct horse"))
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("POST /login code = %d; want %d", res.StatusCode, tc.wantCode)
+			}
+			if tc.wantCode != http.StatusTooManyRequests {
+				return
+			}
+			if res.Header.Get("Retry-After") == "" {
+				t.Errorf("Retry-After header is missing")
+			}
+			htmltest.Parse(t, body).TextEquals("form p.error", "Too many failed attempts. Please try again later")
+		})
+	}
+}
+
+func TestServer_login_resetsAccountLimit(t *testing.T) {
+	const (
+		ip      = "10.0.0.1:1234"
+		otherIP = "10.0.0.2:1234"
+	)
+	server := &app.Server{MaxLoginFailures: 3, PasswordCost: bcrypt.MinCost}
+	for _, email := range []string{"jon@calhoun.io", "bob@example.com"} {
+		submit(t, server, "/signup", "", credentials(email, "correct horse"))
+	}
+	for i := 0; i < 2; i++ {
+		submit(t, server, "/login", ip, credentials("jon@calhoun.io", "wrong password"))
+	}
+	res, _ := submit(t, server, "/login", ip, credentials("jon@calhoun.io", "correct horse"))
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("POST /login code = %d; want %d", res.StatusCode, http.StatusFound)
+	}
+
+	// The successful login cleared the account's failures, so it can fail
+	// twice more from another IP and still log in.
+	for i := 0; i < 2; i++ {
+		submit(t, server, "/login", otherIP, credentials("jon@calhoun.io", "wrong password"))
+	}
+	res, _ = submit(t, server, "/login", otherIP, credentials("jon@calhoun.io", "correct horse"))
+	if res.StatusCode != http.StatusFound {
+		t.Errorf("POST /login for the reset account code = %d; want %d", res.StatusCode, http.StatusFound)
+	}
+
+	// The IP's failures survive the login, so one more reaches the limit.
+	submit(t, server, "/login", ip, credentials("bob@example.com", "wrong password"))
+	res, _ = submit(t, server, "/login", ip, credentials("bob@example.com", "correct horse"))
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("POST /login from the limited IP code = %d; want %d", res.StatusCode, http.StatusTooManyRequests)
+	}
+}
+
+func TestServer_csrf(t *testing.T) {
+	server := httptest.NewServer(&app.Server{PasswordCost: bcrypt.MinCost})
+	defer server.Close()
+	email, password := signUp(t, server.URL)
+
+	tests := map[string]struct {
+		token    func(client *http.Client) string
+		wantCode int
+	}{
+		"token from the form": {
+			token: func(client *http.Client) string {
+				return csrfToken(t, client, server.URL+"/login")
+			},
+			wantCode: http.StatusOK,
+		},
+		"missing token": {
+			token: func(client *http.Client) string {
+				csrfToken(t, client, server.URL+"/login")
+				return ""
+			},
+			wantCode: http.StatusForbidden,
+		},
+		"token from another session": {
+			token: func(client *http.Client) string {
+				csrfToken(t, client, server.URL+"/login")
+				return csrfToken(t, newClient(t), server.URL+"/login")
+			},
+			wantCode: http.StatusForbidden,
+		},
+		"no session": {
+			token: func(client *http.Client) string {
+				return csrfToken(t, newClient(t), server.URL+"/login")
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newClient(t)
+			values := credentials(email, password)
+			values.Set("csrf_token", tc.token(client))
+			res, err := client.PostForm(server.URL+"/login", values)
+			if err != nil {
+				t.Fatalf("POST /login err = %s; want nil", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("POST /login code = %d; want %d", res.StatusCode, tc.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joncalhoun/twg/app/middleware"
+)
+
+// AuditEntry records a single request to an audited route.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	UserID    int       `json:"user_id"`
+	Method    string    `json:"auth_method"`
+	KeyID     string    `json:"key_id,omitempty"`
+	HTTPVerb  string    `json:"http_method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+}
+
+// AuditLog stores audit entries.
+type AuditLog interface {
+	Record(e AuditEntry) error
+	// Entries returns every entry recorded so far, oldest first.
+	Entries() ([]AuditEntry, error)
+}
+
+// MemAuditLog keeps audit entries in memory. The zero value is ready to
+// use and it is safe for concurrent use.
+type MemAuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (mal *MemAuditLog) Record(e AuditEntry) error {
+	mal.mu.Lock()
+	defer mal.mu.Unlock()
+	mal.entries = append(mal.entries, e)
+	return nil
+}
+
+func (mal *MemAuditLog) Entries() ([]AuditEntry, error) {
+	mal.mu.Lock()
+	defer mal.mu.Unlock()
+	return append([]AuditEntry(nil), mal.entries...), nil
+}
+
+// Audit returns middleware that records every request, whether it is
+// allowed or denied, along with the request's principal and the response
+// status. It should be used before authentication, so that requests which
+// fail to authenticate are recorded too. Principals added to the request
+// by later middleware with NewContext are recorded in its entry.
+//
+// requestID is used to fill in AuditEntry.RequestID and may be nil.
+// Failures to record an entry are passed to onError, which may also be
+// nil; they don't affect the response.
+func Audit(log AuditLog, requestID func(*http.Request) string, onError func(error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slot := &auditSlot{principal: FromContext(r.Context())}
+			r = r.WithContext(context.WithValue(r.Context(), auditKey{}, slot))
+			sw := middleware.NewStatusWriter(w)
+			next.ServeHTTP(sw, r)
+
+			e := AuditEntry{
+				Time:     time.Now(),
+				HTTPVerb: r.Method,
+				Path:     r.URL.Path,
+				Status:   sw.Status(),
+			}
+			if requestID != nil {
+				e.RequestID = requestID(r)
+			}
+			if p := slot.principal; p != nil {
+				e.UserID = p.UserID
+				e.Method = p.Method
+				e.KeyID = p.KeyID
+			}
+			if err := log.Record(e); err != nil && onError != nil {
+				onError(err)
+			}
+		})
+	}
+}
+
+type auditKey struct{}
+
+// auditSlot receives the principal of an audited request from NewContext,
+// since middleware after Audit adds it to a request Audit never sees.
+type auditSlot struct {
+	principal *Principal
+}
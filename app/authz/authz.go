@@ -0,0 +1,154 @@
+// Package authz provides role-based authorization for HTTP handlers.
+//
+// Authentication middleware adds a Principal describing who is making the
+// request to its context with NewContext, and RequireRole and
+// RequirePermission then decide whether the principal may continue.
+package authz
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/joncalhoun/twg/app/middleware"
+)
+
+// Role is a named set of permissions granted to a user.
+type Role string
+
+// Permission allows a principal to perform an action.
+type Permission string
+
+const (
+	RoleAdmin   Role = "admin"
+	RoleAuditor Role = "auditor"
+	RoleMember  Role = "member"
+
+	PermViewAdmin Permission = "admin:view"
+	PermViewAudit Permission = "audit:view"
+)
+
+// Policy maps each role to the permissions it grants.
+type Policy map[Role][]Permission
+
+// DefaultPolicy is the policy used by the app.
+var DefaultPolicy = Policy{
+	RoleAdmin:   {PermViewAdmin, PermViewAudit},
+	RoleAuditor: {PermViewAudit},
+	RoleMember:  {},
+}
+
+// Permissions returns every permission granted by the roles, without
+// duplicates.
+func (p Policy) Permissions(roles []Role) []Permission {
+	seen := make(map[Permission]bool)
+	var perms []Permission
+	for _, role := range roles {
+		for _, perm := range p[role] {
+			if !seen[perm] {
+				seen[perm] = true
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return perms
+}
+
+// Authentication methods for Principal.Method.
+const (
+	MethodSession = "session"
+	MethodAPIKey  = "api_key"
+)
+
+// Principal is the authenticated user making a request.
+type Principal struct {
+	UserID int
+	// Method is how the principal authenticated; either MethodSession or
+	// MethodAPIKey. KeyID is set for MethodAPIKey.
+	Method      string
+	KeyID       string
+	Roles       []Role
+	Permissions []Permission
+}
+
+// HasRole reports whether the principal has the role.
+func (p *Principal) HasRole(role Role) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the principal has the permission.
+func (p *Principal) Can(perm Permission) bool {
+	for _, granted := range p.Permissions {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries the principal. If ctx
+// comes from a request being audited, the principal is also recorded in
+// the request's audit entry.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	if slot, ok := ctx.Value(auditKey{}).(*auditSlot); ok {
+		slot.principal = p
+	}
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx by NewContext, or nil if
+// there isn't one.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// RequireRole returns middleware that only calls next if the request's
+// principal has the role. Requests without a principal get a 401 and
+// principals without the role get a 403.
+func RequireRole(role Role) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return p.HasRole(role)
+	})
+}
+
+// RequirePermission is like RequireRole, but checks for a permission.
+func RequirePermission(perm Permission) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return p.Can(perm)
+	})
+}
+
+func require(allowed func(p *Principal) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := FromContext(r.Context())
+			if p == nil {
+				deny(w, p, http.StatusUnauthorized)
+				return
+			}
+			if !allowed(p) {
+				deny(w, p, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deny responds with the status. API clients get a JSON error, matching
+// the errors returned when API key authentication fails.
+func deny(w http.ResponseWriter, p *Principal, status int) {
+	msg := http.StatusText(status)
+	if p == nil || p.Method != MethodAPIKey {
+		http.Error(w, msg, status)
+		return
+	}
+	middleware.JSONError(w, status, msg)
+}
@@ -0,0 +1,189 @@
+package authz_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/joncalhoun/twg/app/authz"
+)
+
+func TestPolicy_Permissions(t *testing.T) {
+	policy := authz.Policy{
+		"a": {"read", "write"},
+		"b": {"write", "delete"},
+	}
+	tests := map[string]struct {
+		roles []authz.Role
+		want  []authz.Permission
+	}{
+		"none":    {nil, nil},
+		"unknown": {[]authz.Role{"c"}, nil},
+		"one":     {[]authz.Role{"a"}, []authz.Permission{"read", "write"}},
+		"merged":  {[]authz.Role{"a", "b"}, []authz.Permission{"read", "write", "delete"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := policy.Permissions(tc.roles)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Permissions(%v) = %v; want %v", tc.roles, got, tc.want)
+			}
+		})
+	}
+}
+
+func principal(method string, roles ...authz.Role) *authz.Principal {
+	return &authz.Principal{
+		UserID:      1,
+		Method:      method,
+		Roles:       roles,
+		Permissions: authz.DefaultPolicy.Permissions(roles),
+	}
+}
+
+func TestRequire(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	principals := map[string]*authz.Principal{
+		"anonymous":       nil,
+		"session member":  principal(authz.MethodSession, authz.RoleMember),
+		"session auditor": principal(authz.MethodSession, authz.RoleAuditor),
+		"session admin":   principal(authz.MethodSession, authz.RoleAdmin),
+		"api member":      principal(authz.MethodAPIKey, authz.RoleMember),
+		"api admin":       principal(authz.MethodAPIKey, authz.RoleAdmin),
+	}
+	middleware := map[string]func(http.Handler) http.Handler{
+		"role admin":       authz.RequireRole(authz.RoleAdmin),
+		"permission admin": authz.RequirePermission(authz.PermViewAdmin),
+		"permission audit": authz.RequirePermission(authz.PermViewAudit),
+	}
+	tests := []struct {
+		principal  string
+		middleware string
+		want       int
+	}{
+		{"anonymous", "role admin", 401},
+		{"anonymous", "permission admin", 401},
+		{"session member", "role admin", 403},
+		{"session member", "permission admin", 403},
+		{"session member", "permission audit", 403},
+		{"session auditor", "role admin", 403},
+		{"session auditor", "permission admin", 403},
+		{"session auditor", "permission audit", 200},
+		{"session admin", "role admin", 200},
+		{"session admin", "permission admin", 200},
+		{"session admin", "permission audit", 200},
+		{"api member", "role admin", 403},
+		{"api member", "permission admin", 403},
+		{"api admin", "role admin", 200},
+		{"api admin", "permission admin", 200},
+	}
+	for _, tc := range tests {
+		t.Run(tc.principal+"/"+tc.middleware, func(t *testing.T) {
+			p := principals[tc.principal]
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if p != nil {
+				r = r.WithContext(authz.NewContext(r.Context(), p))
+			}
+			w := httptest.NewRecorder()
+			middleware[tc.middleware](ok).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("code = %d; want %d", w.Code, tc.want)
+			}
+			if tc.want == 200 {
+				if got := w.Body.String(); got != "ok" {
+					t.Errorf("body = %q; want %q", got, "ok")
+				}
+				return
+			}
+			wantCT := "text/plain; charset=utf-8"
+			if p != nil && p.Method == authz.MethodAPIKey {
+				wantCT = "application/json"
+			}
+			if ct := w.Header().Get("Content-Type"); ct != wantCT {
+				t.Errorf("Content-Type = %q; want %q", ct, wantCT)
+			}
+		})
+	}
+}
+
+type failingLog struct{ authz.MemAuditLog }
+
+func (*failingLog) Record(authz.AuditEntry) error {
+	return errors.New("disk full")
+}
+
+func TestAudit(t *testing.T) {
+	var log authz.MemAuditLog
+	requestID := func(*http.Request) string { return "req-1" }
+	h := authz.Audit(&log, requestID, nil)(
+		authz.RequireRole(authz.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})))
+
+	admin := &authz.Principal{UserID: 1, Method: authz.MethodAPIKey, KeyID: "k1", Roles: []authz.Role{authz.RoleAdmin}}
+	member := &authz.Principal{UserID: 2, Method: authz.MethodSession, Roles: []authz.Role{authz.RoleMember}}
+	for _, p := range []*authz.Principal{admin, member, nil} {
+		r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if p != nil {
+			r = r.WithContext(authz.NewContext(r.Context(), p))
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	entries, err := log.Entries()
+	if err != nil {
+		t.Fatalf("Entries() err = %s; want nil", err)
+	}
+	want := []authz.AuditEntry{
+		{RequestID: "req-1", UserID: 1, Method: authz.MethodAPIKey, KeyID: "k1", HTTPVerb: "GET", Path: "/admin", Status: 200},
+		{RequestID: "req-1", UserID: 2, Method: authz.MethodSession, HTTPVerb: "GET", Path: "/admin", Status: 403},
+		{RequestID: "req-1", HTTPVerb: "GET", Path: "/admin", Status: 401},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("len(Entries()) = %d; want %d", len(entries), len(want))
+	}
+	for i, got := range entries {
+		if got.Time.IsZero() {
+			t.Errorf("Entries()[%d].Time is zero; want it to be set", i)
+		}
+		got.Time = want[i].Time
+		if got != want[i] {
+			t.Errorf("Entries()[%d] = %+v; want %+v", i, got, want[i])
+		}
+	}
+
+	t.Run("principal added after Audit", func(t *testing.T) {
+		var log authz.MemAuditLog
+		authenticate := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(authz.NewContext(r.Context(), member)))
+			})
+		}
+		h := authz.Audit(&log, nil, nil)(authenticate(authz.RequireRole(authz.RoleAdmin)(http.NotFoundHandler())))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin", nil))
+		entries, _ := log.Entries()
+		if len(entries) != 1 || entries[0].UserID != member.UserID || entries[0].Status != http.StatusForbidden {
+			t.Errorf("Entries() = %+v; want one 403 entry for user %d", entries, member.UserID)
+		}
+	})
+
+	t.Run("record error", func(t *testing.T) {
+		var gotErr error
+		h := authz.Audit(&failingLog{}, nil, func(err error) { gotErr = err })(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+		if w.Code != 200 || w.Body.String() != "ok" {
+			t.Errorf("response = %d %q; want 200 %q", w.Code, w.Body.String(), "ok")
+		}
+		if gotErr == nil {
+			t.Errorf("onError was not called; want it called with the Record error")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+// Package csrf protects against cross-site request forgery using
+// synchronizer tokens stored in each visitor's session.
+//
+// Forms include the token from their session as a hidden field, which a
+// page on another site can't read, so a forged request can't provide it.
+package csrf
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/joncalhoun/twg/app/session"
+)
+
+const (
+	// FieldName is the name of the form field the token is read from.
+	FieldName = "csrf_token"
+	// HeaderName is the request header the token is read from when the form
+	// field isn't set, for use by JavaScript clients.
+	HeaderName = "X-CSRF-Token"
+)
+
+// Protect returns middleware that rejects POST, PUT, PATCH and DELETE
+// requests with a 403 unless they include the CSRF token for their
+// session.
+//
+// Token and Field can be used by handlers behind Protect. Visitors without
+// a session are given one the first time either is called for them, so
+// that the forms rendered for them can be submitted, while requests that
+// never render a form don't create sessions. Existing sessions are also
+// added to the request's context.
+func Protect(sm *session.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			st := &state{sm: sm, r: r}
+			s, err := sm.Load(r)
+			switch {
+			case err == nil:
+				st.s = s
+				r = r.WithContext(session.NewContext(r.Context(), s))
+			case !safe(r.Method):
+				forbidden(w)
+				return
+			}
+			if !safe(r.Method) && !valid(r, s) {
+				forbidden(w)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stateKey{}, st)))
+		})
+	}
+}
+
+type stateKey struct{}
+
+// state holds the request's session, starting a new one the first time it
+// is needed if the request didn't have one.
+type state struct {
+	sm   *session.Manager
+	r    *http.Request
+	once sync.Once
+	s    *session.Session
+}
+
+// session returns the request's session. If a new one is started, its
+// cookie is set on w.
+func (st *state) session(w http.ResponseWriter) *session.Session {
+	st.once.Do(func() {
+		if st.s != nil {
+			return
+		}
+		s, err := st.sm.Start(w, st.r, 0)
+		if err == nil {
+			st.s = s
+		}
+	})
+	return st.s
+}
+
+func forbidden(w http.ResponseWriter) {
+	http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+}
+
+func safe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func valid(r *http.Request, s *session.Session) bool {
+	token := r.PostFormValue(FieldName)
+	if token == "" {
+		token = r.Header.Get(HeaderName)
+	}
+	if token == "" || s.CSRFToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.CSRFToken)) == 1
+}
+
+// Token returns the CSRF token for the request's session. It returns an
+// empty string unless the request has passed through Protect.
+//
+// If the visitor doesn't have a session yet, Token starts one and sets the
+// session cookie on w, so it must be called before the response is
+// written. w doesn't have to be the ResponseWriter the handler was given;
+// view.Engine passes one that only sends the cookie if the page renders.
+func Token(w http.ResponseWriter, r *http.Request) string {
+	st, _ := r.Context().Value(stateKey{}).(*state)
+	if st == nil {
+		return ""
+	}
+	s := st.session(w)
+	if s == nil {
+		return ""
+	}
+	return s.CSRFToken
+}
+
+// Field returns a hidden input with the request's CSRF token, suitable for
+// including in a form template. Like Token, it may set a session cookie
+// on w.
+func Field(w http.ResponseWriter, r *http.Request) template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		FieldName, template.HTMLEscapeString(Token(w, r))))
+}
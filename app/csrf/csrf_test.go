@@ -0,0 +1,164 @@
+package csrf_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/twg/app/csrf"
+	"github.com/joncalhoun/twg/app/session"
+)
+
+func manager() *session.Manager {
+	return &session.Manager{
+		Store: &session.MemStore{},
+		Key:   []byte("test-key-that-is-not-very-secret"),
+	}
+}
+
+// tokenHandler writes the request's token so tests can read it.
+var tokenHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, csrf.Token(w, r))
+})
+
+func TestProtect_get(t *testing.T) {
+	h := csrf.Protect(manager())(tokenHandler)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET / code = %d; want %d", w.Code, http.StatusOK)
+	}
+	if w.Body.String() == "" {
+		t.Errorf("Token() = %q; want a token", w.Body.String())
+	}
+	if len(w.Result().Cookies()) != 1 {
+		t.Errorf("GET / set %d cookies; want 1 session cookie", len(w.Result().Cookies()))
+	}
+}
+
+func TestProtect_lazy(t *testing.T) {
+	sm := manager()
+	calls := 0
+	h := csrf.Protect(sm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, "no forms here")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if calls != 1 {
+		t.Fatalf("handler called %d times; want 1", calls)
+	}
+	if n := len(w.Result().Cookies()); n != 0 {
+		t.Errorf("GET / without a token set %d cookies; want 0", n)
+	}
+
+	// Asking for the token more than once must not start more sessions.
+	h = csrf.Protect(sm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, second := csrf.Token(w, r), csrf.Token(w, r)
+		if first == "" || first != second {
+			t.Errorf("Token() = %q, then %q; want the same token twice", first, second)
+		}
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if n := len(w.Result().Cookies()); n != 1 {
+		t.Errorf("GET / with a token set %d cookies; want 1", n)
+	}
+}
+
+func TestToken_writer(t *testing.T) {
+	// The session cookie goes on the writer given to Token, not the one
+	// Protect was given.
+	var tw *httptest.ResponseRecorder
+	h := csrf.Protect(manager())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw = httptest.NewRecorder()
+		csrf.Token(tw, r)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if n := len(w.Result().Cookies()); n != 0 {
+		t.Errorf("response set %d cookies; want 0", n)
+	}
+	if n := len(tw.Result().Cookies()); n != 1 {
+		t.Errorf("Token() writer got %d cookies; want 1", n)
+	}
+}
+
+func TestProtect_post(t *testing.T) {
+	sm := manager()
+	h := csrf.Protect(sm)(tokenHandler)
+	s, err := sm.New(1)
+	if err != nil {
+		t.Fatalf("New() err = %s; want nil", err)
+	}
+	cookie, err := sm.Cookie(s)
+	if err != nil {
+		t.Fatalf("Cookie() err = %s; want nil", err)
+	}
+
+	tests := map[string]struct {
+		method   string
+		cookie   *http.Cookie
+		field    string
+		header   string
+		wantCode int
+	}{
+		"form field":       {http.MethodPost, cookie, s.CSRFToken, "", http.StatusOK},
+		"header":           {http.MethodDelete, cookie, "", s.CSRFToken, http.StatusOK},
+		"missing token":    {http.MethodPost, cookie, "", "", http.StatusForbidden},
+		"wrong token":      {http.MethodPut, cookie, "wrong", "", http.StatusForbidden},
+		"no session":       {http.MethodPost, nil, s.CSRFToken, "", http.StatusForbidden},
+		"wrong header":     {http.MethodPatch, cookie, "", "wrong", http.StatusForbidden},
+		"safe w/o a token": {http.MethodHead, cookie, "", "", http.StatusOK},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			form := url.Values{}
+			if tc.field != "" {
+				form.Set(csrf.FieldName, tc.field)
+			}
+			r := httptest.NewRequest(tc.method, "/", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.header != "" {
+				r.Header.Set(csrf.HeaderName, tc.header)
+			}
+			if tc.cookie != nil {
+				r.AddCookie(tc.cookie)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.wantCode {
+				t.Errorf("%s / code = %d; want %d", tc.method, w.Code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestField(t *testing.T) {
+	sm := manager()
+	var got string
+	h := csrf.Protect(sm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = string(csrf.Field(w, r))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	s, err := sm.Load(r)
+	if err != nil {
+		t.Fatalf("Load() err = %s; want nil", err)
+	}
+	want := `<input type="hidden" name="csrf_token" value="` + s.CSRFToken + `">`
+	if got != want {
+		t.Errorf("Field() = %s; want %s", got, want)
+	}
+
+	if got := csrf.Token(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)); got != "" {
+		t.Errorf("Token() without Protect = %q; want %q", got, "")
+	}
+}
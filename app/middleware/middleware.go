@@ -0,0 +1,231 @@
+// Package middleware provides HTTP middleware for request IDs, panic
+// recovery, access logging and gzip compression. Each of those functions
+// returns or is a router.Middleware. StatusWriter and JSONError are shared
+// with middleware in other packages.
+package middleware
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Logger is used to log requests and panics. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// RequestIDHeader is the header used to read and write request IDs.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID gives each request an ID, which is available via
+// GetRequestID and is set in the response's X-Request-ID header. If the
+// request already has an X-Request-ID header, for example from a proxy, it
+// is used instead of generating a new one.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID returns the request ID set by RequestID, or an empty string
+// if there isn't one.
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	// If crypto/rand fails there is little we can do, and the ID is only
+	// used for correlating logs, so an all zero ID is acceptable.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recover returns middleware that recovers from panics in handlers, logs
+// them with a stack trace and responds with a 500 if nothing has been
+// written yet. http.ErrAbortHandler is re-panicked so the server can abort
+// the response as intended.
+func Recover(logger Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := NewStatusWriter(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				logger.Printf("panic serving %s %s (request %s): %v\n%s",
+					r.Method, r.URL.Path, GetRequestID(r.Context()), v, debug.Stack())
+				if !sw.wroteHeader {
+					http.Error(sw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// AccessLog returns middleware that logs each request's method, path,
+// status, response size, duration and request ID.
+func AccessLog(logger Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := NewStatusWriter(w)
+			next.ServeHTTP(sw, r)
+			logger.Printf("%s %s %d %dB %s request_id=%s",
+				r.Method, r.URL.RequestURI(), sw.Status(), sw.Written(), time.Since(start), GetRequestID(r.Context()))
+		})
+	}
+}
+
+// StatusWriter records the status code and number of bytes written to a
+// ResponseWriter. Use NewStatusWriter to create one.
+type StatusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	written     int
+}
+
+// NewStatusWriter wraps w in a StatusWriter. If w is already a
+// *StatusWriter it is returned as is, so nested middleware share a single
+// record of what was written.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	if sw, ok := w.(*StatusWriter); ok {
+		return sw
+	}
+	return &StatusWriter{ResponseWriter: w}
+}
+
+func (sw *StatusWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.code = code
+	sw.wroteHeader = true
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *StatusWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.written += n
+	return n, err
+}
+
+// Status returns the status code sent, which is http.StatusOK if nothing
+// has been written yet.
+func (sw *StatusWriter) Status() int {
+	if !sw.wroteHeader {
+		return http.StatusOK
+	}
+	return sw.code
+}
+
+// Written returns the number of body bytes written.
+func (sw *StatusWriter) Written() int {
+	return sw.written
+}
+
+// JSONError responds with the status and a JSON body of the form
+// {"error": msg}. It is the error format used by every JSON endpoint in
+// the app.
+func JSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+// Gzip compresses responses for clients that accept gzip encoding.
+// Responses that already have a Content-Encoding, and responses without a
+// body, are left alone.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(strings.Split(enc, ";")[0])
+		if enc == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (gw *gzipWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	h := gw.Header()
+	if bodyAllowed(code) && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(code)
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		// The server would otherwise sniff the compressed bytes.
+		if gw.Header().Get("Content-Type") == "" {
+			gw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.gz == nil {
+		return gw.ResponseWriter.Write(b)
+	}
+	return gw.gz.Write(b)
+}
+
+func (gw *gzipWriter) close() {
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+func bodyAllowed(code int) bool {
+	return !(code >= 100 && code < 200) && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -0,0 +1,196 @@
+package middleware_test
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/twg/app/middleware"
+)
+
+type fakeLogger struct {
+	sb strings.Builder
+}
+
+func (fl *fakeLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(&fl.sb, format, v...)
+	fl.sb.WriteString("\n")
+}
+
+func TestRequestID(t *testing.T) {
+	var got string
+	h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = middleware.GetRequestID(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got == "" {
+		t.Errorf("GetRequestID() = %q; want a generated ID", got)
+	}
+	if header := w.Header().Get(middleware.RequestIDHeader); header != got {
+		t.Errorf("X-Request-ID = %q; want %q", header, got)
+	}
+	first := got
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got == first {
+		t.Errorf("GetRequestID() = %q for two requests; want unique IDs", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(middleware.RequestIDHeader, "from-proxy")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got != "from-proxy" {
+		t.Errorf("GetRequestID() = %q; want %q", got, "from-proxy")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := map[string]struct {
+		handler  http.HandlerFunc
+		wantCode int
+		wantBody string
+	}{
+		"panic before writing": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("oh no")
+			},
+			wantCode: 500,
+			wantBody: "Internal Server Error\n",
+		},
+		"panic after writing": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprint(w, "partial")
+				panic("oh no")
+			},
+			wantCode: http.StatusAccepted,
+			wantBody: "partial",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var logger fakeLogger
+			h := middleware.Recover(&logger)(tc.handler)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+			if w.Code != tc.wantCode {
+				t.Errorf("code = %d; want %d", w.Code, tc.wantCode)
+			}
+			if w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q; want %q", w.Body.String(), tc.wantBody)
+			}
+			if !strings.Contains(logger.sb.String(), "panic serving GET /boom") || !strings.Contains(logger.sb.String(), "oh no") {
+				t.Errorf("logs = %q; want the panic to be logged", logger.sb.String())
+			}
+		})
+	}
+}
+
+func TestRecover_abort(t *testing.T) {
+	h := middleware.Recover(&fakeLogger{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recover() = %v; want %v", v, http.ErrAbortHandler)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestAccessLog(t *testing.T) {
+	var logger fakeLogger
+	h := middleware.RequestID(middleware.AccessLog(&logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprint(w, "short and stout")
+	})))
+	r := httptest.NewRequest(http.MethodPost, "/pot?brew=1", nil)
+	r.Header.Set(middleware.RequestIDHeader, "abc")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	want := regexp.MustCompile(`^POST /pot\?brew=1 418 15B \S+ request_id=abc\n$`)
+	if !want.MatchString(logger.sb.String()) {
+		t.Errorf("logs = %q; want a match for %s", logger.sb.String(), want)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	const body = "<h1>Hello, gzip!</h1>"
+	tests := map[string]struct {
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantEncoding   string
+		wantBody       string
+	}{
+		"accepted": {
+			acceptEncoding: "deflate, gzip;q=0.8",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, body)
+			},
+			wantEncoding: "gzip",
+			wantBody:     body,
+		},
+		"not accepted": {
+			acceptEncoding: "deflate",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, body)
+			},
+			wantBody: body,
+		},
+		"already encoded": {
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				fmt.Fprint(w, "brotli bytes")
+			},
+			wantEncoding: "br",
+			wantBody:     "brotli bytes",
+		},
+		"no content": {
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			w := httptest.NewRecorder()
+			middleware.Gzip(tc.handler).ServeHTTP(w, r)
+
+			res := w.Result()
+			if got := res.Header.Get("Content-Encoding"); got != tc.wantEncoding {
+				t.Errorf("Content-Encoding = %q; want %q", got, tc.wantEncoding)
+			}
+			if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q; want %q", got, "Accept-Encoding")
+			}
+			var raw = res.Body
+			if tc.wantEncoding == "gzip" {
+				if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+					t.Errorf("Content-Type = %q; want text/html", got)
+				}
+				gz, err := gzip.NewReader(res.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() err = %s; want nil", err)
+				}
+				raw = gz
+			}
+			got, err := ioutil.ReadAll(raw)
+			if err != nil {
+				t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+			}
+			if string(got) != tc.wantBody {
+				t.Errorf("body = %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
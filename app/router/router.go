@@ -0,0 +1,289 @@
+// Package router provides a small HTTP router with method matching, path
+// parameters and route groups.
+//
+// Patterns are paths whose segments are either literal or a parameter
+// written as {name}:
+//
+//	rt := router.New()
+//	rt.Get("/people/{id}", func(w http.ResponseWriter, r *http.Request) {
+//		fmt.Fprint(w, router.Param(r, "id"))
+//	})
+//
+// Literal segments take priority over parameters, so /people/new matches
+// a route for /people/new before one for /people/{id}. If a path matches
+// a route but not its method, the router sets an Allow header listing the
+// methods that are supported and responds with a 405.
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a handler with additional behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies the middleware to h so that the first middleware is the
+// outermost.
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Router is an http.Handler that dispatches requests to the handler for
+// their method and path. Routes, middleware and the NotFound and
+// MethodNotAllowed handlers must all be set before the Router starts
+// serving requests; handlers are chained with their middleware once, on
+// the first request.
+type Router struct {
+	// NotFound handles requests that don't match any route. Defaults to
+	// http.NotFound.
+	NotFound http.Handler
+	// MethodNotAllowed handles requests whose path matches a route but
+	// whose method doesn't. The Allow header is already set when it is
+	// called. Defaults to a plain text 405 error.
+	MethodNotAllowed http.Handler
+
+	table  *table
+	parent *Router
+	prefix string
+	mw     []Middleware
+}
+
+type table struct {
+	routes []route
+
+	once    sync.Once
+	handler http.Handler
+}
+
+type route struct {
+	method   string
+	segments []string
+	handler  http.Handler
+	group    *Router
+	// chained is handler wrapped with the middleware of its groups. It is
+	// set by build.
+	chained http.Handler
+}
+
+// New returns an empty Router.
+func New() *Router {
+	return &Router{
+		table: &table{},
+	}
+}
+
+// Use adds middleware to the router. Middleware added to the root router
+// wraps every request, including those that don't match a route, while
+// middleware added to a group only wraps the routes in that group.
+func (rt *Router) Use(mw ...Middleware) {
+	rt.mw = append(rt.mw, mw...)
+}
+
+// Group returns a router that adds routes to rt with the prefix and with
+// the middleware applied to them, in addition to any middleware used by rt
+// and its parents.
+func (rt *Router) Group(prefix string, mw ...Middleware) *Router {
+	return &Router{
+		table:  rt.table,
+		parent: rt,
+		prefix: rt.prefix + strings.TrimRight(prefix, "/"),
+		mw:     mw,
+	}
+}
+
+// Handle registers the handler for requests with the method and a path
+// matching the pattern.
+func (rt *Router) Handle(method, pattern string, h http.Handler) {
+	rt.table.routes = append(rt.table.routes, route{
+		method:   method,
+		segments: split(rt.prefix + pattern),
+		handler:  h,
+		group:    rt,
+	})
+}
+
+// HandleFunc is like Handle, but with an http.HandlerFunc.
+func (rt *Router) HandleFunc(method, pattern string, h http.HandlerFunc) {
+	rt.Handle(method, pattern, h)
+}
+
+func (rt *Router) Get(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodGet, pattern, h)
+}
+
+func (rt *Router) Post(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodPost, pattern, h)
+}
+
+func (rt *Router) Put(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodPut, pattern, h)
+}
+
+func (rt *Router) Patch(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodPatch, pattern, h)
+}
+
+func (rt *Router) Delete(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodDelete, pattern, h)
+}
+
+// ServeHTTP dispatches the request. Calling it on a group is the same as
+// calling it on the root router.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	root := rt
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.table.once.Do(root.build)
+	root.table.handler.ServeHTTP(w, r)
+}
+
+// build chains every route's handler with the middleware of its groups,
+// and the root router's middleware around dispatch. It must be called on
+// the root router.
+func (rt *Router) build() {
+	for i := range rt.table.routes {
+		rte := &rt.table.routes[i]
+		// Group middleware is applied from the outermost group inwards.
+		// The root router's middleware wraps dispatch instead.
+		var groups []*Router
+		for g := rte.group; g.parent != nil; g = g.parent {
+			groups = append(groups, g)
+		}
+		var mw []Middleware
+		for j := len(groups) - 1; j >= 0; j-- {
+			mw = append(mw, groups[j].mw...)
+		}
+		rte.chained = Chain(rte.handler, mw...)
+	}
+	rt.table.handler = Chain(http.HandlerFunc(rt.dispatch), rt.mw...)
+}
+
+func (rt *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	segments := split(r.URL.Path)
+	var best *route
+	var params map[string]string
+	allowed := make(map[string]bool)
+	for i := range rt.table.routes {
+		rte := &rt.table.routes[i]
+		p, ok := match(rte.segments, segments)
+		if !ok {
+			continue
+		}
+		allowed[rte.method] = true
+		if rte.method == http.MethodGet {
+			allowed[http.MethodHead] = true
+		}
+		if !methodMatches(rte.method, r.Method) {
+			continue
+		}
+		if best == nil || morePrecise(rte, best, r.Method) {
+			best, params = rte, p
+		}
+	}
+
+	if best == nil {
+		if len(allowed) > 0 {
+			methods := make([]string, 0, len(allowed))
+			for m := range allowed {
+				methods = append(methods, m)
+			}
+			sort.Strings(methods)
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			if rt.MethodNotAllowed != nil {
+				rt.MethodNotAllowed.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		notFound := rt.NotFound
+		if notFound == nil {
+			notFound = http.HandlerFunc(http.NotFound)
+		}
+		notFound.ServeHTTP(w, r)
+		return
+	}
+
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+	}
+	best.chained.ServeHTTP(w, r)
+}
+
+// methodMatches reports whether a route for routeMethod can handle a
+// request with reqMethod. GET routes also handle HEAD requests.
+func methodMatches(routeMethod, reqMethod string) bool {
+	return routeMethod == reqMethod ||
+		(routeMethod == http.MethodGet && reqMethod == http.MethodHead)
+}
+
+// morePrecise reports whether a is a better match for the request than b.
+// A route for the exact method beats a GET route handling a HEAD request,
+// and otherwise the route with a literal segment where the other has a
+// parameter wins.
+func morePrecise(a, b *route, method string) bool {
+	if (a.method == method) != (b.method == method) {
+		return a.method == method
+	}
+	for i := range a.segments {
+		aParam, bParam := isParam(a.segments[i]), isParam(b.segments[i])
+		if aParam != bParam {
+			return bParam
+		}
+	}
+	return false
+}
+
+func match(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, seg := range pattern {
+		if isParam(seg) {
+			if segments[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:len(seg)-1]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func isParam(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+// split returns the segments of a path, ignoring leading and trailing
+// slashes.
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+type paramsKey struct{}
+
+// Param returns the value of the named path parameter for the route that
+// matched r, or an empty string if there is no such parameter.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
@@ -0,0 +1,182 @@
+package router_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/twg/app/router"
+)
+
+// reply returns a handler that writes its name and any path parameters.
+func reply(name string, params ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, name)
+		for _, p := range params {
+			fmt.Fprintf(w, " %s=%s", p, router.Param(r, p))
+		}
+	}
+}
+
+// trace returns middleware that appends its name to the X-Trace header.
+func trace(name string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	rt := router.New()
+	rt.Get("/", reply("home"))
+	rt.Get("/people", reply("list"))
+	rt.Post("/people", reply("create"))
+	rt.Get("/people/new", reply("new"))
+	rt.Get("/people/{id}", reply("show", "id"))
+	rt.Put("/people/{id}", reply("update", "id"))
+	rt.Get("/people/{id}/pets/{pet}", reply("pet", "id", "pet"))
+	rt.Handle(http.MethodHead, "/head", reply("explicit head"))
+	rt.Get("/head", reply("get"))
+
+	tests := []struct {
+		method    string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{"GET", "/", 200, "home", ""},
+		{"GET", "/people", 200, "list", ""},
+		{"GET", "/people/", 200, "list", ""},
+		{"POST", "/people", 200, "create", ""},
+		{"GET", "/people/new", 200, "new", ""},
+		{"GET", "/people/123", 200, "show id=123", ""},
+		{"PUT", "/people/123", 200, "update id=123", ""},
+		{"GET", "/people/1/pets/spot", 200, "pet id=1 pet=spot", ""},
+		// The recorder keeps bodies written for HEAD requests, which lets
+		// us check which handler was used.
+		{"HEAD", "/people/123", 200, "show id=123", ""},
+		{"HEAD", "/head", 200, "explicit head", ""},
+		{"DELETE", "/people/123", 405, "Method Not Allowed\n", "GET, HEAD, PUT"},
+		{"DELETE", "/people", 405, "Method Not Allowed\n", "GET, HEAD, POST"},
+		{"GET", "/missing", 404, "404 page not found\n", ""},
+		{"GET", "/people/1/pets", 404, "404 page not found\n", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+			if w.Code != tc.wantCode {
+				t.Errorf("code = %d; want %d", w.Code, tc.wantCode)
+			}
+			if w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q; want %q", w.Body.String(), tc.wantBody)
+			}
+			if got := w.Header().Get("Allow"); got != tc.wantAllow {
+				t.Errorf("Allow = %q; want %q", got, tc.wantAllow)
+			}
+		})
+	}
+}
+
+func TestRouter_groups(t *testing.T) {
+	rt := router.New()
+	rt.Use(trace("root"))
+	rt.Get("/", reply("home"))
+	api := rt.Group("/api", trace("api"))
+	api.Get("/people/{id}", reply("person", "id"))
+	admin := api.Group("/admin/", trace("admin"))
+	admin.Use(trace("admin2"))
+	admin.Get("/stats", reply("stats"))
+
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantBody  string
+		wantTrace string
+	}{
+		{"/", 200, "home", "root"},
+		{"/api/people/7", 200, "person id=7", "root api"},
+		{"/api/admin/stats", 200, "stats", "root api admin admin2"},
+		{"/stats", 404, "404 page not found\n", "root"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.wantCode {
+				t.Errorf("code = %d; want %d", w.Code, tc.wantCode)
+			}
+			if w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q; want %q", w.Body.String(), tc.wantBody)
+			}
+			if got := strings.Join(w.Header()["X-Trace"], " "); got != tc.wantTrace {
+				t.Errorf("X-Trace = %q; want %q", got, tc.wantTrace)
+			}
+		})
+	}
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	rt := router.New()
+	rt.NotFound = reply("custom")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Body.String() != "custom" {
+		t.Errorf("body = %q; want %q", w.Body.String(), "custom")
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	rt := router.New()
+	rt.Get("/people", reply("list"))
+	rt.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "custom allow=%s", w.Header().Get("Allow"))
+	})
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/people", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("code = %d; want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if want := "custom allow=GET, HEAD"; w.Body.String() != want {
+		t.Errorf("body = %q; want %q", w.Body.String(), want)
+	}
+}
+
+func TestRouter_chainsOnce(t *testing.T) {
+	calls := make(map[string]int)
+	counted := func(name string) router.Middleware {
+		return func(next http.Handler) http.Handler {
+			calls[name]++
+			return next
+		}
+	}
+	rt := router.New()
+	rt.Use(counted("root"))
+	api := rt.Group("/api", counted("api"))
+	api.Get("/people", reply("list"))
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/people", nil))
+		if w.Body.String() != "list" {
+			t.Fatalf("body = %q; want %q", w.Body.String(), "list")
+		}
+	}
+	for _, name := range []string{"root", "api"} {
+		if calls[name] != 1 {
+			t.Errorf("%s middleware applied %d times; want 1", name, calls[name])
+		}
+	}
+}
+
+func TestParam_missing(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := router.Param(r, "id"); got != "" {
+		t.Errorf("Param() = %q; want %q", got, "")
+	}
+}
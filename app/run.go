@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Config configures Run. Zero values are replaced with the values from
+// DefaultConfig.
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is how long Run waits for in-flight requests to
+	// complete when shutting down.
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long Run keeps serving requests after /readyz
+	// starts failing and before it shuts down, giving load balancers time
+	// to stop sending it traffic. Zero means no delay.
+	DrainDelay time.Duration
+	// InsecureCookies is passed on to the default Handler. See
+	// Server.InsecureCookies.
+	InsecureCookies bool
+
+	// Handler serves every request other than /healthz and /readyz.
+	// Defaults to a new Server.
+	Handler http.Handler
+	// Ready, if set, is called by /readyz. The server is reported as not
+	// ready if it returns an error.
+	Ready func(ctx context.Context) error
+	// Listener, if set, is used instead of listening on Addr.
+	Listener net.Listener
+}
+
+// DefaultConfig returns the default configuration.
+func DefaultConfig() Config {
+	return Config{
+		Addr:              ":3000",
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   15 * time.Second,
+	}
+}
+
+func (cfg Config) withDefaults() Config {
+	def := DefaultConfig()
+	if cfg.Addr == "" {
+		cfg.Addr = def.Addr
+	}
+	for _, d := range []struct {
+		val *time.Duration
+		def time.Duration
+	}{
+		{&cfg.ReadTimeout, def.ReadTimeout},
+		{&cfg.ReadHeaderTimeout, def.ReadHeaderTimeout},
+		{&cfg.WriteTimeout, def.WriteTimeout},
+		{&cfg.IdleTimeout, def.IdleTimeout},
+		{&cfg.ShutdownTimeout, def.ShutdownTimeout},
+	} {
+		if *d.val <= 0 {
+			*d.val = d.def
+		}
+	}
+	if cfg.Handler == nil {
+		cfg.Handler = &Server{InsecureCookies: cfg.InsecureCookies}
+	}
+	return cfg
+}
+
+// ParseConfig parses the server's command line flags. Each flag defaults
+// to the environment variable shown in its usage, as returned by getenv,
+// and then to the value from DefaultConfig.
+func ParseConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	addr := getenv("APP_ADDR")
+	if addr == "" {
+		addr = cfg.Addr
+	}
+	fs.StringVar(&cfg.Addr, "addr", addr, "address to listen on (APP_ADDR)")
+	durations := []struct {
+		val   *time.Duration
+		name  string
+		env   string
+		usage string
+	}{
+		{&cfg.ReadTimeout, "read-timeout", "APP_READ_TIMEOUT", "maximum duration for reading an entire request"},
+		{&cfg.ReadHeaderTimeout, "read-header-timeout", "APP_READ_HEADER_TIMEOUT", "maximum duration for reading request headers"},
+		{&cfg.WriteTimeout, "write-timeout", "APP_WRITE_TIMEOUT", "maximum duration for writing a response"},
+		{&cfg.IdleTimeout, "idle-timeout", "APP_IDLE_TIMEOUT", "how long to keep idle keep-alive connections open"},
+		{&cfg.ShutdownTimeout, "shutdown-timeout", "APP_SHUTDOWN_TIMEOUT", "how long to wait for requests to complete when shutting down"},
+		{&cfg.DrainDelay, "drain-delay", "APP_DRAIN_DELAY", "how long to keep serving after /readyz starts failing, before shutting down"},
+	}
+	for _, d := range durations {
+		def := *d.val
+		if v := getenv(d.env); v != "" {
+			var err error
+			def, err = time.ParseDuration(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("app: invalid %s: %w", d.env, err)
+			}
+		}
+		fs.DurationVar(d.val, d.name, def, d.usage+" ("+d.env+")")
+	}
+	insecure := false
+	if v := getenv("APP_INSECURE_COOKIES"); v != "" {
+		var err error
+		insecure, err = strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("app: invalid APP_INSECURE_COOKIES: %w", err)
+		}
+	}
+	fs.BoolVar(&cfg.InsecureCookies, "insecure-cookies", insecure, "send cookies over plain HTTP, for local development (APP_INSECURE_COOKIES)")
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Run serves HTTP requests until ctx is cancelled or the process receives
+// SIGINT or SIGTERM. It then fails /readyz for cfg.DrainDelay while still
+// serving requests, stops accepting new connections and waits up to
+// cfg.ShutdownTimeout for in-flight requests to complete.
+//
+// In addition to cfg.Handler, /healthz always responds with a 200 while
+// the server is running, and /readyz responds with a 200 unless the server
+// is shutting down or cfg.Ready returns an error.
+//
+// Run returns nil if the server shut down cleanly.
+func Run(ctx context.Context, cfg Config) error {
+	cfg = cfg.withDefaults()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var draining int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&draining) == 1 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if cfg.Ready != nil {
+			if err := cfg.Ready(r.Context()); err != nil {
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprint(w, "ok")
+	})
+	mux.Handle("/", cfg.Handler)
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	ln := cfg.Listener
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", cfg.Addr)
+		if err != nil {
+			return err
+		}
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	atomic.StoreInt32(&draining, 1)
+	if cfg.DrainDelay > 0 {
+		time.Sleep(cfg.DrainDelay)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		srv.Close()
+		return fmt.Errorf("app: shutting down: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/twg/app"
+)
+
+func TestParseConfig(t *testing.T) {
+	def := app.DefaultConfig()
+	tests := map[string]struct {
+		args    []string
+		env     map[string]string
+		want    func(cfg *app.Config)
+		wantErr bool
+	}{
+		"defaults": {
+			want: func(cfg *app.Config) {},
+		},
+		"env": {
+			env: map[string]string{
+				"APP_ADDR":             ":8080",
+				"APP_WRITE_TIMEOUT":    "1m",
+				"APP_SHUTDOWN_TIMEOUT": "3s",
+				"APP_DRAIN_DELAY":      "5s",
+			},
+			want: func(cfg *app.Config) {
+				cfg.Addr = ":8080"
+				cfg.WriteTimeout = time.Minute
+				cfg.ShutdownTimeout = 3 * time.Second
+				cfg.DrainDelay = 5 * time.Second
+			},
+		},
+		"flags override env": {
+			args: []string{"-addr", "127.0.0.1:9000", "-read-timeout", "2s"},
+			env: map[string]string{
+				"APP_ADDR":         ":8080",
+				"APP_READ_TIMEOUT": "1m",
+			},
+			want: func(cfg *app.Config) {
+				cfg.Addr = "127.0.0.1:9000"
+				cfg.ReadTimeout = 2 * time.Second
+			},
+		},
+		"insecure cookies": {
+			args: []string{"-insecure-cookies"},
+			want: func(cfg *app.Config) {
+				cfg.InsecureCookies = true
+			},
+		},
+		"insecure cookies env": {
+			env: map[string]string{"APP_INSECURE_COOKIES": "true"},
+			want: func(cfg *app.Config) {
+				cfg.InsecureCookies = true
+			},
+		},
+		"invalid env": {
+			env:     map[string]string{"APP_IDLE_TIMEOUT": "forever"},
+			wantErr: true,
+		},
+		"invalid bool env": {
+			env:     map[string]string{"APP_INSECURE_COOKIES": "maybe"},
+			wantErr: true,
+		},
+		"invalid flag": {
+			args:    []string{"-idle-timeout", "forever"},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			getenv := func(key string) string {
+				return tc.env[key]
+			}
+			got, err := app.ParseConfig(tc.args, getenv)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParseConfig() err = nil; want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConfig() err = %s; want nil", err)
+			}
+			want := def
+			tc.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseConfig() = %+v; want %+v", got, want)
+			}
+		})
+	}
+}
+
+// run starts app.Run in a goroutine and returns its base URL, a function to
+// stop it and a channel that receives Run's return value.
+func run(t *testing.T, cfg app.Config) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() err = %s; want nil", err)
+	}
+	cfg.Listener = ln
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- app.Run(ctx, cfg)
+	}()
+	t.Cleanup(cancel)
+	return "http://" + ln.Addr().String(), cancel, errCh
+}
+
+func waitForRun(t *testing.T, errCh <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run() didn't return after its context was cancelled")
+		return nil
+	}
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s err = %s; want nil", url, err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+	}
+	return res.StatusCode, string(body)
+}
+
+func TestRun(t *testing.T) {
+	var ready error
+	baseURL, cancel, errCh := run(t, app.Config{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "handler")
+		}),
+		Ready: func(ctx context.Context) error {
+			return ready
+		},
+	})
+
+	tests := []struct {
+		path     string
+		ready    error
+		wantCode int
+		wantBody string
+	}{
+		{"/", nil, 200, "handler"},
+		{"/healthz", nil, 200, "ok"},
+		{"/readyz", nil, 200, "ok"},
+		{"/readyz", errors.New("db is down"), 503, "not ready\n"},
+		{"/healthz", errors.New("db is down"), 200, "ok"},
+	}
+	for _, tc := range tests {
+		ready = tc.ready
+		code, body := get(t, baseURL+tc.path)
+		if code != tc.wantCode || body != tc.wantBody {
+			t.Errorf("GET %s (ready err = %v) = %d, %q; want %d, %q", tc.path, tc.ready, code, body, tc.wantCode, tc.wantBody)
+		}
+	}
+
+	cancel()
+	if err := waitForRun(t, errCh); err != nil {
+		t.Errorf("Run() err = %s; want nil", err)
+	}
+	if _, err := http.Get(baseURL + "/healthz"); err == nil {
+		t.Errorf("GET /healthz after shutdown err = nil; want an error")
+	}
+}
+
+func TestRun_drain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	baseURL, cancel, errCh := run(t, app.Config{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			fmt.Fprint(w, "done")
+		}),
+	})
+
+	type result struct {
+		code int
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		res, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		resCh <- result{res.StatusCode, string(body), err}
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("Run() returned %v before in-flight requests completed", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	res := <-resCh
+	if res.err != nil {
+		t.Fatalf("in-flight GET /slow err = %s; want nil", res.err)
+	}
+	if res.code != 200 || res.body != "done" {
+		t.Errorf("in-flight GET /slow = %d, %q; want %d, %q", res.code, res.body, 200, "done")
+	}
+	if err := waitForRun(t, errCh); err != nil {
+		t.Errorf("Run() err = %s; want nil", err)
+	}
+}
+
+func TestRun_drainDelay(t *testing.T) {
+	baseURL, cancel, errCh := run(t, app.Config{
+		DrainDelay: 500 * time.Millisecond,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "handler")
+		}),
+	})
+	cancel()
+
+	// Run marks itself as draining right after the context is cancelled,
+	// then keeps serving until the delay is over.
+	deadline := time.Now().Add(250 * time.Millisecond)
+	code, body := get(t, baseURL+"/readyz")
+	for code == http.StatusOK && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		code, body = get(t, baseURL+"/readyz")
+	}
+	if code != http.StatusServiceUnavailable || body != "shutting down\n" {
+		t.Errorf("GET /readyz while draining = %d, %q; want %d, %q", code, body, http.StatusServiceUnavailable, "shutting down\n")
+	}
+	if code, body := get(t, baseURL+"/"); code != http.StatusOK || body != "handler" {
+		t.Errorf("GET / while draining = %d, %q; want %d, %q", code, body, http.StatusOK, "handler")
+	}
+	if err := waitForRun(t, errCh); err != nil {
+		t.Errorf("Run() err = %s; want nil", err)
+	}
+}
+
+func TestRun_shutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	baseURL, cancel, errCh := run(t, app.Config{
+		ShutdownTimeout: 50 * time.Millisecond,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+	})
+	go http.Get(baseURL + "/stuck")
+	<-started
+	cancel()
+	err := waitForRun(t, errCh)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() err = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRun_listenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() err = %s; want nil", err)
+	}
+	defer ln.Close()
+	err = app.Run(context.Background(), app.Config{Addr: ln.Addr().String()})
+	if err == nil {
+		t.Errorf("Run() on an address in use err = nil; want an error")
+	}
+}
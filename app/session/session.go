@@ -0,0 +1,257 @@
+// Package session provides server-side sessions that are identified by a
+// signed cookie.
+//
+// Session data is kept in a Store and the cookie only holds the session's
+// random ID along with an HMAC of it, so a cookie can't be forged without
+// the Manager's key and a session can be ended on the server at any time.
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a session doesn't exist or has expired.
+	ErrNotFound = errors.New("session: not found")
+	// ErrInvalidCookie is returned when a session cookie is malformed or
+	// its signature doesn't match.
+	ErrInvalidCookie = errors.New("session: invalid cookie")
+	// ErrNoKey is returned when a Manager is used without a Key.
+	ErrNoKey = errors.New("session: Manager.Key is required")
+)
+
+const (
+	// DefaultCookieName is used when Manager.CookieName is empty.
+	DefaultCookieName = "session"
+	// DefaultTTL is used when Manager.TTL is zero.
+	DefaultTTL = 24 * time.Hour
+)
+
+// Session is a single visitor's session. UserID is zero for visitors who
+// haven't signed in. Sessions are never updated once created; a new
+// session is created instead.
+type Session struct {
+	ID     string
+	UserID int
+	// CSRFToken is a random token that forms must submit to prove they
+	// were rendered for this session.
+	CSRFToken string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the session has expired as of now.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// Store persists sessions. Get returns ErrNotFound if there is no session
+// with the ID. Delete returns nil if there is no session to delete.
+type Store interface {
+	Create(s *Session) error
+	Get(id string) (*Session, error)
+	Delete(id string) error
+}
+
+// Manager creates sessions and reads and writes session cookies.
+type Manager struct {
+	Store Store
+	// Key is used to sign session cookies. It should be at least 32 random
+	// bytes; see GenerateKey.
+	Key []byte
+	// TTL is how long a session lasts. Defaults to DefaultTTL.
+	TTL time.Duration
+	// CookieName defaults to DefaultCookieName.
+	CookieName string
+	// Insecure leaves the Secure attribute off session cookies so that
+	// browsers send them over plain HTTP. It should only be set when
+	// developing locally.
+	Insecure bool
+}
+
+// GenerateKey returns a random key suitable for Manager.Key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("session: generating key: %w", err)
+	}
+	return key, nil
+}
+
+func (m *Manager) ttl() time.Duration {
+	if m.TTL > 0 {
+		return m.TTL
+	}
+	return DefaultTTL
+}
+
+func (m *Manager) cookieName() string {
+	if m.CookieName != "" {
+		return m.CookieName
+	}
+	return DefaultCookieName
+}
+
+// New creates and stores a new session for the user. Most callers should
+// use Start, which also sets the session cookie.
+func (m *Manager) New(userID int) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	token, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		ID:        id,
+		UserID:    userID,
+		CSRFToken: token,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl()),
+	}
+	err = m.Store.Create(s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start creates a new session for the user and sets the session cookie.
+// Any session the request already had is deleted, so a session ID is
+// never reused across a login.
+func (m *Manager) Start(w http.ResponseWriter, r *http.Request, userID int) (*Session, error) {
+	if len(m.Key) == 0 {
+		return nil, ErrNoKey
+	}
+	if id, err := m.id(r); err == nil {
+		if err := m.Store.Delete(id); err != nil {
+			return nil, err
+		}
+	}
+	s, err := m.New(userID)
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := m.Cookie(s)
+	if err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, cookie)
+	return s, nil
+}
+
+// Load returns the session for the request's session cookie. Expired
+// sessions are deleted and ErrNotFound is returned.
+func (m *Manager) Load(r *http.Request) (*Session, error) {
+	id, err := m.id(r)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Expired(time.Now()) {
+		if err := m.Store.Delete(s.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// Destroy deletes the request's session, if it has one, and clears the
+// session cookie.
+func (m *Manager) Destroy(w http.ResponseWriter, r *http.Request) error {
+	if id, err := m.id(r); err == nil {
+		if err := m.Store.Delete(id); err != nil {
+			return err
+		}
+	}
+	cookie := m.cookie("", -1)
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// Cookie returns a signed cookie for the session.
+func (m *Manager) Cookie(s *Session) (*http.Cookie, error) {
+	if len(m.Key) == 0 {
+		return nil, ErrNoKey
+	}
+	value := s.ID + "." + m.sign(s.ID)
+	return m.cookie(value, int(time.Until(s.ExpiresAt).Seconds())), nil
+}
+
+func (m *Manager) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   !m.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// id returns the session ID from the request's cookie after verifying its
+// signature.
+func (m *Manager) id(r *http.Request) (string, error) {
+	if len(m.Key) == 0 {
+		return "", ErrNoKey
+	}
+	c, err := r.Cookie(m.cookieName())
+	if err != nil {
+		return "", ErrNotFound
+	}
+	parts := strings.Split(c.Value, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidCookie
+	}
+	id, sig := parts[0], parts[1]
+	if !hmac.Equal([]byte(sig), []byte(m.sign(id))) {
+		return "", ErrInvalidCookie
+	}
+	return id, nil
+}
+
+func (m *Manager) sign(id string) string {
+	mac := hmac.New(sha256.New, m.Key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newID() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("session: generating ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries the session.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns the session stored in ctx by NewContext, or nil if
+// there isn't one.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(ctxKey{}).(*Session)
+	return s
+}
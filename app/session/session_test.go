@@ -0,0 +1,224 @@
+package session_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/twg/app/session"
+)
+
+func manager() *session.Manager {
+	return &session.Manager{
+		Store: &session.MemStore{},
+		Key:   []byte("test-key-that-is-not-very-secret"),
+	}
+}
+
+// withCookies returns a request with all of the cookies set on w.
+func withCookies(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestManager_Start(t *testing.T) {
+	m := manager()
+	w := httptest.NewRecorder()
+	s, err := m.Start(w, httptest.NewRequest(http.MethodPost, "/login", nil), 7)
+	if err != nil {
+		t.Fatalf("Start() err = %s; want nil", err)
+	}
+	if s.UserID != 7 {
+		t.Errorf("Start() UserID = %d; want %d", s.UserID, 7)
+	}
+	if s.CSRFToken == "" {
+		t.Errorf("Start() CSRFToken is empty; want a random token")
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Start() set %d cookies; want 1", len(cookies))
+	}
+	c := cookies[0]
+	if c.Name != session.DefaultCookieName {
+		t.Errorf("cookie Name = %q; want %q", c.Name, session.DefaultCookieName)
+	}
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie HttpOnly, Secure, SameSite = %t, %t, %v; want true, true, %v", c.HttpOnly, c.Secure, c.SameSite, http.SameSiteLaxMode)
+	}
+
+	got, err := m.Load(withCookies(w))
+	if err != nil {
+		t.Fatalf("Load() err = %s; want nil", err)
+	}
+	if got.ID != s.ID {
+		t.Errorf("Load() ID = %q; want %q", got.ID, s.ID)
+	}
+}
+
+func TestManager_Start_insecure(t *testing.T) {
+	m := manager()
+	m.Insecure = true
+	w := httptest.NewRecorder()
+	_, err := m.Start(w, httptest.NewRequest(http.MethodPost, "/login", nil), 7)
+	if err != nil {
+		t.Fatalf("Start() err = %s; want nil", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Start() set %d cookies; want 1", len(cookies))
+	}
+	if cookies[0].Secure {
+		t.Errorf("cookie Secure = true; want false")
+	}
+}
+
+func TestManager_Start_rotates(t *testing.T) {
+	m := manager()
+	first := httptest.NewRecorder()
+	old, err := m.Start(first, httptest.NewRequest(http.MethodPost, "/login", nil), 1)
+	if err != nil {
+		t.Fatalf("Start() err = %s; want nil", err)
+	}
+	oldReq := withCookies(first)
+
+	second := httptest.NewRecorder()
+	s, err := m.Start(second, oldReq, 1)
+	if err != nil {
+		t.Fatalf("Start() err = %s; want nil", err)
+	}
+	if s.ID == old.ID {
+		t.Errorf("Start() reused session ID %q; want a new one", s.ID)
+	}
+	if s.CSRFToken == old.CSRFToken {
+		t.Errorf("Start() reused CSRF token %q; want a new one", s.CSRFToken)
+	}
+	_, err = m.Load(oldReq)
+	if err != session.ErrNotFound {
+		t.Errorf("Load() with the old cookie err = %v; want %v", err, session.ErrNotFound)
+	}
+	if _, err := m.Load(withCookies(second)); err != nil {
+		t.Errorf("Load() with the new cookie err = %s; want nil", err)
+	}
+}
+
+func TestManager_Load_invalid(t *testing.T) {
+	m := manager()
+	s, err := m.New(1)
+	if err != nil {
+		t.Fatalf("New() err = %s; want nil", err)
+	}
+	valid, err := m.Cookie(s)
+	if err != nil {
+		t.Fatalf("Cookie() err = %s; want nil", err)
+	}
+	other := manager()
+	other.Key = []byte("a-different-key")
+	otherCookie, err := other.Cookie(s)
+	if err != nil {
+		t.Fatalf("Cookie() err = %s; want nil", err)
+	}
+
+	// Signatures are checked before the store, so deleting the session only
+	// affects the "unknown ID" case.
+	if err := m.Store.Delete(s.ID); err != nil {
+		t.Fatalf("Delete() err = %s; want nil", err)
+	}
+
+	tests := map[string]struct {
+		cookie *http.Cookie
+		want   error
+	}{
+		"no cookie":  {nil, session.ErrNotFound},
+		"unsigned":   {&http.Cookie{Name: "session", Value: s.ID}, session.ErrInvalidCookie},
+		"tampered":   {&http.Cookie{Name: "session", Value: "x" + valid.Value}, session.ErrInvalidCookie},
+		"wrong key":  {otherCookie, session.ErrInvalidCookie},
+		"unknown ID": {valid, session.ErrNotFound},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.cookie != nil {
+				r.AddCookie(tc.cookie)
+			}
+			_, err := m.Load(r)
+			if err != tc.want {
+				t.Errorf("Load() err = %v; want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestManager_Load_expired(t *testing.T) {
+	m := manager()
+	s := &session.Session{
+		ID:        "expired",
+		UserID:    1,
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	}
+	if err := m.Store.Create(s); err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	c, err := m.Cookie(s)
+	if err != nil {
+		t.Fatalf("Cookie() err = %s; want nil", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	_, err = m.Load(r)
+	if err != session.ErrNotFound {
+		t.Errorf("Load() err = %v; want %v", err, session.ErrNotFound)
+	}
+	if _, err := m.Store.Get(s.ID); err != session.ErrNotFound {
+		t.Errorf("Get() expired session err = %v; want %v", err, session.ErrNotFound)
+	}
+}
+
+func TestManager_Destroy(t *testing.T) {
+	m := manager()
+	w := httptest.NewRecorder()
+	_, err := m.Start(w, httptest.NewRequest(http.MethodPost, "/login", nil), 1)
+	if err != nil {
+		t.Fatalf("Start() err = %s; want nil", err)
+	}
+	r := withCookies(w)
+
+	w = httptest.NewRecorder()
+	err = m.Destroy(w, r)
+	if err != nil {
+		t.Fatalf("Destroy() err = %s; want nil", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Destroy() cookies = %v; want one cookie with a negative MaxAge", cookies)
+	}
+	_, err = m.Load(r)
+	if err != session.ErrNotFound {
+		t.Errorf("Load() after Destroy() err = %v; want %v", err, session.ErrNotFound)
+	}
+}
+
+func TestManager_noKey(t *testing.T) {
+	m := &session.Manager{Store: &session.MemStore{}}
+	_, err := m.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil), 1)
+	if err != session.ErrNoKey {
+		t.Errorf("Start() err = %v; want %v", err, session.ErrNoKey)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if s := session.FromContext(context.Background()); s != nil {
+		t.Errorf("FromContext() = %+v; want nil", s)
+	}
+	want := &session.Session{ID: "abc"}
+	got := session.FromContext(session.NewContext(context.Background(), want))
+	if got != want {
+		t.Errorf("FromContext() = %+v; want %+v", got, want)
+	}
+}
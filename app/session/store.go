@@ -0,0 +1,131 @@
+package session
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// DefaultSweepInterval is used when MemStore.SweepInterval is zero.
+const DefaultSweepInterval = time.Minute
+
+// MemStore stores sessions in memory. The zero value is ready to use and
+// it is safe for concurrent use.
+//
+// Expired sessions are only deleted by Load when a visitor comes back, so
+// Create also sweeps out every expired session once per SweepInterval to
+// keep abandoned sessions from piling up.
+type MemStore struct {
+	// SweepInterval is how often Create deletes expired sessions.
+	// Defaults to DefaultSweepInterval.
+	SweepInterval time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]Session
+	lastSweep time.Time
+}
+
+func (ms *MemStore) Create(s *Session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.sessions == nil {
+		ms.sessions = make(map[string]Session)
+	}
+	now := time.Now()
+	interval := ms.SweepInterval
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	if now.Sub(ms.lastSweep) >= interval {
+		ms.deleteExpired(now)
+		ms.lastSweep = now
+	}
+	ms.sessions[s.ID] = *s
+	return nil
+}
+
+func (ms *MemStore) Get(id string) (*Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	s, ok := ms.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (ms *MemStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.sessions, id)
+	return nil
+}
+
+// DeleteExpired deletes every session that has expired as of now and
+// returns how many were deleted.
+func (ms *MemStore) DeleteExpired(now time.Time) int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.deleteExpired(now)
+}
+
+func (ms *MemStore) deleteExpired(now time.Time) int {
+	n := 0
+	for id, s := range ms.sessions {
+		if s.Expired(now) {
+			delete(ms.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+// CreateSQLTable creates the table used by SQLStore.
+const CreateSQLTable = `CREATE TABLE sessions (
+	id TEXT PRIMARY KEY,
+	user_id INT NOT NULL,
+	csrf_token TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);`
+
+// NewSQLStore returns a SQLStore using db, which must be a Postgres
+// database with the table from CreateSQLTable.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{
+		sql: db,
+	}
+}
+
+// SQLStore stores sessions in a Postgres database.
+type SQLStore struct {
+	sql interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+		QueryRow(query string, args ...interface{}) *sql.Row
+	}
+}
+
+func (ss *SQLStore) Create(s *Session) error {
+	_, err := ss.sql.Exec(`INSERT INTO sessions (id, user_id, csrf_token, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5);`, s.ID, s.UserID, s.CSRFToken, s.CreatedAt, s.ExpiresAt)
+	return err
+}
+
+func (ss *SQLStore) Get(id string) (*Session, error) {
+	var s Session
+	row := ss.sql.QueryRow(`SELECT id, user_id, csrf_token, created_at, expires_at
+		FROM sessions WHERE id=$1;`, id)
+	err := row.Scan(&s.ID, &s.UserID, &s.CSRFToken, &s.CreatedAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (ss *SQLStore) Delete(id string) error {
+	_, err := ss.sql.Exec(`DELETE FROM sessions WHERE id=$1;`, id)
+	return err
+}
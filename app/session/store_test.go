@@ -0,0 +1,94 @@
+package session_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/twg/app/session"
+	"github.com/joncalhoun/twg/psql/psqltest"
+)
+
+func TestMemStore(t *testing.T) {
+	testStore(t, &session.MemStore{})
+}
+
+func TestMemStore_DeleteExpired(t *testing.T) {
+	now := time.Now()
+	store := &session.MemStore{}
+	for _, s := range []*session.Session{
+		{ID: "expired", ExpiresAt: now.Add(-time.Minute)},
+		{ID: "live", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := store.Create(s); err != nil {
+			t.Fatalf("Create() err = %s; want nil", err)
+		}
+	}
+	if got := store.DeleteExpired(now); got != 1 {
+		t.Errorf("DeleteExpired() = %d; want %d", got, 1)
+	}
+	if _, err := store.Get("expired"); err != session.ErrNotFound {
+		t.Errorf("Get(expired) err = %v; want %v", err, session.ErrNotFound)
+	}
+	if _, err := store.Get("live"); err != nil {
+		t.Errorf("Get(live) err = %s; want nil", err)
+	}
+}
+
+func TestMemStore_sweep(t *testing.T) {
+	store := &session.MemStore{SweepInterval: time.Nanosecond}
+	expired := &session.Session{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := store.Create(expired); err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	time.Sleep(time.Millisecond)
+	live := &session.Session{ID: "live", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.Create(live); err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	if _, err := store.Get("expired"); err != session.ErrNotFound {
+		t.Errorf("Get(expired) after sweep err = %v; want %v", err, session.ErrNotFound)
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	db := psqltest.DB(t, session.CreateSQLTable)
+	testStore(t, session.NewSQLStore(db))
+}
+
+func testStore(t *testing.T, store session.Store) {
+	// Times are truncated so they survive a round trip through stores
+	// with less precision than time.Time.
+	now := time.Now().Truncate(time.Second)
+	want := &session.Session{
+		ID:        "abc123",
+		UserID:    7,
+		CSRFToken: "token",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	err := store.Create(want)
+	if err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	got, err := store.Get(want.ID)
+	if err != nil {
+		t.Fatalf("Get() err = %s; want nil", err)
+	}
+	if got.ID != want.ID || got.UserID != want.UserID || got.CSRFToken != want.CSRFToken ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("Get() = %+v; want %+v", got, want)
+	}
+
+	err = store.Delete(want.ID)
+	if err != nil {
+		t.Fatalf("Delete() err = %s; want nil", err)
+	}
+	_, err = store.Get(want.ID)
+	if err != session.ErrNotFound {
+		t.Errorf("Get() after Delete() err = %v; want %v", err, session.ErrNotFound)
+	}
+	err = store.Delete(want.ID)
+	if err != nil {
+		t.Errorf("Delete() missing session err = %s; want nil", err)
+	}
+}
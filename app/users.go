@@ -0,0 +1,77 @@
+package app
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/joncalhoun/twg/app/authz"
+)
+
+// Errors returned by a UserStore.
+var (
+	ErrNotFound   = errors.New("app: user not found")
+	ErrEmailTaken = errors.New("app: email is taken")
+)
+
+// User is an account that can sign in to the app.
+type User struct {
+	ID           int
+	Email        string
+	PasswordHash string
+	// Roles determine what the user is allowed to do. Users created via
+	// the signup page are given authz.RoleMember.
+	Roles []authz.Role
+}
+
+// UserStore persists users. It mirrors suite.UserStore, but users have a
+// password hash. Emails are expected to be normalized before they are
+// passed to a UserStore.
+type UserStore interface {
+	Create(*User) error
+	ByID(id int) (*User, error)
+	ByEmail(email string) (*User, error)
+}
+
+// MemUserStore stores users in memory. The zero value is ready to use and
+// it is safe for concurrent use.
+type MemUserStore struct {
+	mu     sync.Mutex
+	users  []User
+	nextID int
+}
+
+func (mus *MemUserStore) Create(user *User) error {
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+	for _, u := range mus.users {
+		if u.Email == user.Email {
+			return ErrEmailTaken
+		}
+	}
+	mus.nextID++
+	user.ID = mus.nextID
+	mus.users = append(mus.users, *user)
+	return nil
+}
+
+func (mus *MemUserStore) ByID(id int) (*User, error) {
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+	for _, u := range mus.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (mus *MemUserStore) ByEmail(email string) (*User, error) {
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+	for _, u := range mus.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
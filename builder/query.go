@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query is used to build SQL SELECT statements. Conditions are written
+// using ? for placeholders, which are replaced with numbered placeholders
+// ($1, $2, ...) when the SQL is generated, so conditions can be combined
+// without worrying about their order.
+//
+//	query, args, err := Select("id", "name").From("users").
+//		Where("name LIKE ?", "Jon%").
+//		OrderBy("id").
+//		Limit(10).
+//		SQL()
+//
+// Results in the query:
+//
+//	SELECT id, name FROM users WHERE name LIKE $1 ORDER BY id LIMIT 10;
+//
+// Column and table names are written into the query as-is, so they must
+// never come from user input. Values should always be passed as args.
+type Query struct {
+	columns []string
+	table   string
+	where   []condition
+	orderBy []string
+	limit   int
+	// err is the first mistake made while building the query. SQL
+	// returns it.
+	err error
+}
+
+type condition struct {
+	sql  string
+	args []interface{}
+}
+
+// Select starts a new query for the provided columns.
+func Select(columns ...string) *Query {
+	return &Query{
+		columns: columns,
+	}
+}
+
+// From sets the table being queried.
+func (q *Query) From(table string) *Query {
+	q.table = table
+	return q
+}
+
+// Where adds a condition to the query. Multiple conditions are combined
+// with AND. The number of ? placeholders in cond must match the number of
+// args; if it doesn't, SQL returns an error.
+//
+// A ? inside a quoted string or identifier, such as name = '?', is left
+// alone. Every other ? is a placeholder, so Postgres operators that contain
+// ?, like the jsonb operators ?, ?| and ?&, can't be used. Use functions
+// such as jsonb_exists instead.
+func (q *Query) Where(cond string, args ...interface{}) *Query {
+	if n := len(placeholders(cond)); n != len(args) {
+		if q.err == nil {
+			q.err = fmt.Errorf("builder: condition %q has %d placeholders but %d args", cond, n, len(args))
+		}
+		return q
+	}
+	q.where = append(q.where, condition{
+		sql:  cond,
+		args: args,
+	})
+	return q
+}
+
+// WhereIn adds a condition that column is one of the provided values. If
+// values is empty no rows will match.
+func (q *Query) WhereIn(column string, values ...interface{}) *Query {
+	if len(values) == 0 {
+		return q.Where("FALSE")
+	}
+	placeholders := strings.Repeat("?, ", len(values))
+	placeholders = strings.TrimSuffix(placeholders, ", ")
+	return q.Where(fmt.Sprintf("%s IN (%s)", column, placeholders), values...)
+}
+
+// OrderBy sets the columns used to order results, eg "id" or "name DESC".
+func (q *Query) OrderBy(columns ...string) *Query {
+	q.orderBy = columns
+	return q
+}
+
+// Limit sets the maximum number of rows returned. A limit of zero means
+// there is no limit.
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// SQL returns the SQL for the query along with the args that should be
+// passed alongside it. It returns an error if any of the query's
+// conditions were invalid.
+func (q *Query) SQL() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	var sb strings.Builder
+	var args []interface{}
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(q.columns, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(q.table)
+	for i, cond := range q.where {
+		if i == 0 {
+			sb.WriteString(" WHERE ")
+		} else {
+			sb.WriteString(" AND ")
+		}
+		if len(q.where) > 1 {
+			sb.WriteString("(")
+		}
+		// Replace each ? with the next numbered placeholder.
+		start := 0
+		for j, at := range placeholders(cond.sql) {
+			sb.WriteString(cond.sql[start:at])
+			args = append(args, cond.args[j])
+			sb.WriteString("$")
+			sb.WriteString(strconv.Itoa(len(args)))
+			start = at + 1
+		}
+		sb.WriteString(cond.sql[start:])
+		if len(q.where) > 1 {
+			sb.WriteString(")")
+		}
+	}
+	if len(q.orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(q.orderBy, ", "))
+	}
+	if q.limit > 0 {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(strconv.Itoa(q.limit))
+	}
+	sb.WriteString(";")
+	return sb.String(), args, nil
+}
+
+// escapeLike escapes the characters that have a special meaning in a LIKE
+// pattern so that s only matches itself.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// placeholders returns the index of each ? in cond that is a placeholder,
+// skipping any inside single quoted strings or double quoted identifiers.
+// A doubled quote, which escapes a quote inside a quoted section, ends
+// that section and starts another, so it needs no special handling.
+func placeholders(cond string) []int {
+	var indexes []int
+	var quote byte
+	for i := 0; i < len(cond); i++ {
+		switch c := cond[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,138 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuery_SQL(t *testing.T) {
+	tests := map[string]struct {
+		query    *Query
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		"select": {
+			query:   Select("id", "name").From("users"),
+			wantSQL: "SELECT id, name FROM users;",
+		},
+		"single condition": {
+			query:    Select("id").From("users").Where("id = ?", 123),
+			wantSQL:  "SELECT id FROM users WHERE id = $1;",
+			wantArgs: []interface{}{123},
+		},
+		"multiple conditions": {
+			query: Select("id").From("users").
+				Where("name = ?", "Jon").
+				Where("age > ? OR age < ?", 10, 5),
+			wantSQL:  "SELECT id FROM users WHERE (name = $1) AND (age > $2 OR age < $3);",
+			wantArgs: []interface{}{"Jon", 10, 5},
+		},
+		"where in": {
+			query:    Select("id").From("users").Where("name = ?", "Jon").WhereIn("id", 1, 2, 3),
+			wantSQL:  "SELECT id FROM users WHERE (name = $1) AND (id IN ($2, $3, $4));",
+			wantArgs: []interface{}{"Jon", 1, 2, 3},
+		},
+		"where in empty": {
+			query:   Select("id").From("users").WhereIn("id"),
+			wantSQL: "SELECT id FROM users WHERE FALSE;",
+		},
+		"quoted question marks": {
+			query:    Select("id").From("users").Where(`name = '?' AND "why?" = ? AND bio <> 'it''s ?'`, 1),
+			wantSQL:  `SELECT id FROM users WHERE name = '?' AND "why?" = $1 AND bio <> 'it''s ?';`,
+			wantArgs: []interface{}{1},
+		},
+		"order and limit": {
+			query:   Select("id").From("users").OrderBy("name DESC", "id").Limit(10),
+			wantSQL: "SELECT id FROM users ORDER BY name DESC, id LIMIT 10;",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotSQL, gotArgs, err := tc.query.SQL()
+			if err != nil {
+				t.Fatalf("SQL() err = %s; want nil", err)
+			}
+			if gotSQL != tc.wantSQL {
+				t.Errorf("SQL() query = %q; want %q", gotSQL, tc.wantSQL)
+			}
+			if !reflect.DeepEqual(gotArgs, tc.wantArgs) {
+				t.Errorf("SQL() args = %v; want %v", gotArgs, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestQuery_Where_invalidArgs(t *testing.T) {
+	q := Select("id").From("users").
+		Where("id = ? AND name = ?", 123).
+		Where("email = ?", "jon@calhoun.io")
+	query, args, err := q.SQL()
+	if err == nil {
+		t.Fatalf("SQL() = %q, %v; want an error", query, args)
+	}
+	want := `builder: condition "id = ? AND name = ?" has 2 placeholders but 1 args`
+	if err.Error() != want {
+		t.Errorf("SQL() err = %q; want %q", err, want)
+	}
+}
+
+func TestUserFilter_query(t *testing.T) {
+	tests := map[string]struct {
+		filter   UserFilter
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		"empty filter": {
+			filter:  UserFilter{},
+			wantSQL: "SELECT id, name, email FROM users ORDER BY id;",
+		},
+		"name prefix": {
+			filter:   UserFilter{NamePrefix: "Jon"},
+			wantSQL:  "SELECT id, name, email FROM users WHERE name LIKE $1 ORDER BY id;",
+			wantArgs: []interface{}{"Jon%"},
+		},
+		"name prefix with wildcards": {
+			filter:   UserFilter{NamePrefix: `50%_off\`},
+			wantSQL:  "SELECT id, name, email FROM users WHERE name LIKE $1 ORDER BY id;",
+			wantArgs: []interface{}{`50\%\_off\\%`},
+		},
+		"email domain": {
+			filter:   UserFilter{EmailDomain: "calhoun.io"},
+			wantSQL:  "SELECT id, name, email FROM users WHERE email ILIKE $1 ORDER BY id;",
+			wantArgs: []interface{}{"%@calhoun.io"},
+		},
+		"ids": {
+			filter:   UserFilter{IDs: []int{1, 2}},
+			wantSQL:  "SELECT id, name, email FROM users WHERE id IN ($1, $2) ORDER BY id;",
+			wantArgs: []interface{}{1, 2},
+		},
+		"empty ids": {
+			filter:  UserFilter{IDs: []int{}},
+			wantSQL: "SELECT id, name, email FROM users WHERE FALSE ORDER BY id;",
+		},
+		"everything": {
+			filter: UserFilter{
+				NamePrefix:  "Jon",
+				EmailDomain: "calhoun.io",
+				IDs:         []int{1},
+				Limit:       5,
+			},
+			wantSQL:  "SELECT id, name, email FROM users WHERE (name LIKE $1) AND (email ILIKE $2) AND (id IN ($3)) ORDER BY id LIMIT 5;",
+			wantArgs: []interface{}{"Jon%", "%@calhoun.io", 1},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotSQL, gotArgs, err := tc.filter.query().SQL()
+			if err != nil {
+				t.Fatalf("SQL() err = %s; want nil", err)
+			}
+			if gotSQL != tc.wantSQL {
+				t.Errorf("SQL() query = %q; want %q", gotSQL, tc.wantSQL)
+			}
+			if !reflect.DeepEqual(gotArgs, tc.wantArgs) {
+				t.Errorf("SQL() args = %v; want %v", gotArgs, tc.wantArgs)
+			}
+		})
+	}
+}
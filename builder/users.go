@@ -21,10 +21,29 @@ type User struct {
 	Email string
 }
 
+// UserFilter is used to filter users returned by UserStore.Where. Only
+// users that match every non-zero field are returned.
+type UserFilter struct {
+	// NamePrefix matches users whose name starts with it.
+	NamePrefix string
+	// EmailDomain matches users with an email address at the domain,
+	// ignoring case. Eg "calhoun.io" matches "jon@calhoun.io".
+	EmailDomain string
+	// IDs matches users with any of the IDs. A non-nil, empty slice
+	// matches no users.
+	IDs []int
+	// Limit is the maximum number of users returned. Zero means no limit.
+	Limit int
+}
+
+// userColumns are the columns needed to scan a User, in order.
+var userColumns = []string{"id", "name", "email"}
+
 // UserStore is used to interact with our user store.
 type UserStore struct {
 	sql interface {
 		Exec(query string, args ...interface{}) (sql.Result, error)
+		Query(query string, args ...interface{}) (*sql.Rows, error)
 		QueryRow(query string, args ...interface{}) *sql.Row
 	}
 }
@@ -33,10 +52,13 @@ type UserStore struct {
 // if the user isn't located. Other errors are wrapped with context
 // but are otherwise wrapped as-is.
 func (us *UserStore) Find(id int) (*User, error) {
-	const query = `SELECT id, name, email FROM users WHERE id=$1;`
-	row := us.sql.QueryRow(query, id)
+	query, args, err := Select(userColumns...).From("users").Where("id = ?", id).SQL()
+	if err != nil {
+		return nil, err
+	}
+	row := us.sql.QueryRow(query, args...)
 	var user User
-	err := row.Scan(&user.ID, &user.Name, &user.Email)
+	err = row.Scan(&user.ID, &user.Name, &user.Email)
 	switch err {
 	case sql.ErrNoRows:
 		return nil, ErrNotFound
@@ -47,6 +69,51 @@ func (us *UserStore) Find(id int) (*User, error) {
 	}
 }
 
+// Where returns all of the users that match the filter, ordered by ID.
+func (us *UserStore) Where(filter UserFilter) ([]User, error) {
+	query, args, err := filter.query().SQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := us.sql.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "builder: error querying for users")
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Name, &user.Email)
+		if err != nil {
+			return nil, errors.Wrap(err, "builder: error scanning user")
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "builder: error querying for users")
+	}
+	return users, nil
+}
+
+// query returns the Query used to find users matching the filter.
+func (f UserFilter) query() *Query {
+	q := Select(userColumns...).From("users")
+	if f.NamePrefix != "" {
+		q.Where("name LIKE ?", escapeLike(f.NamePrefix)+"%")
+	}
+	if f.EmailDomain != "" {
+		q.Where("email ILIKE ?", "%@"+escapeLike(f.EmailDomain))
+	}
+	if f.IDs != nil {
+		ids := make([]interface{}, len(f.IDs))
+		for i, id := range f.IDs {
+			ids[i] = id
+		}
+		q.WhereIn("id", ids...)
+	}
+	return q.OrderBy("id").Limit(f.Limit)
+}
+
 // Create will create a new user in the DB using the provided user and
 // will update the ID of the provided user. If there is an error it will
 // be wrapped and returned.
@@ -1,85 +1,43 @@
 package builder
 
 import (
-	"database/sql"
-	"fmt"
-	"os"
 	"reflect"
 	"testing"
 
-	_ "github.com/lib/pq"
+	"github.com/joncalhoun/twg/fixtures"
+	"github.com/joncalhoun/twg/psql/psqltest"
 )
 
-func TestMain(m *testing.M) {
-	// 0. flag.Parse() if you need flags
-	exitCode := run(m)
-	os.Exit(exitCode)
-}
-
-func run(m *testing.M) int {
-	const (
-		dropDB          = `DROP DATABASE IF EXISTS test_user_store;`
-		createDB        = `CREATE DATABASE test_user_store;`
-		createUserTable = `CREATE TABLE users (
-												 id SERIAL PRIMARY KEY,
-												 name TEXT,
-												 email TEXT UNIQUE NOT NULL
-											 );`
-	)
-
-	builder, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer builder.Close()
+const createUserTable = `CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	name TEXT,
+	email TEXT UNIQUE NOT NULL
+);`
 
-	_, err = builder.Exec(dropDB)
-	if err != nil {
-		panic(fmt.Errorf("builder.Exec() err = %s", err))
-	}
-	_, err = builder.Exec(createDB)
-	if err != nil {
-		panic(fmt.Errorf("builder.Exec() err = %s", err))
-	}
-	// teardown
-	defer func() {
-		_, err = builder.Exec(dropDB)
-		if err != nil {
-			panic(fmt.Errorf("builder.Exec() err = %s", err))
-		}
-	}()
-
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer db.Close()
-	_, err = db.Exec(createUserTable)
-	if err != nil {
-		panic(fmt.Errorf("db.Exec() err = %s", err))
+// userStore returns a UserStore backed by a fresh database that is
+// dropped once the test completes.
+func userStore(t *testing.T) *UserStore {
+	t.Helper()
+	return &UserStore{
+		sql: psqltest.DB(t, createUserTable),
 	}
-
-	return m.Run()
 }
 
-func userStore(t *testing.T) (*UserStore, func()) {
-	t.Helper()
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		t.Fatalf("sql.Open() err = %s", err)
-		return nil, nil
-	}
-	us := &UserStore{
-		sql: db,
-	}
-	return us, func() {
-		db.Close()
+// fixtureStore adapts us so the fixtures package can create users in it.
+func fixtureStore(us *UserStore) fixtures.Store {
+	return fixtures.Store{
+		Create: func(user *fixtures.User) error {
+			u := &User{Name: user.Name, Email: user.Email}
+			err := us.Create(u)
+			user.ID = u.ID
+			return err
+		},
+		Delete: us.Delete,
 	}
 }
 
 func TestUserStore(t *testing.T) {
-	us, teardown := userStore(t)
-	defer teardown()
+	us := userStore(t)
 	t.Run("Find", testUserStore_Find(us))
 	t.Run("Create", testUserStore_Find(us))
 	t.Run("Delete", testUserStore_Find(us))
@@ -88,20 +46,12 @@ func TestUserStore(t *testing.T) {
 
 func testUserStore_Find(us *UserStore) func(t *testing.T) {
 	return func(t *testing.T) {
+		f := fixtures.NewUser().WithName("Jon Calhoun").Create(t, fixtureStore(us))
 		jon := &User{
-			Name:  "Jon Calhoun",
-			Email: "jon@calhoun.io",
-		}
-		err := us.Create(jon)
-		if err != nil {
-			t.Errorf("us.Create() err = %s", err)
+			ID:    f.ID,
+			Name:  f.Name,
+			Email: f.Email,
 		}
-		defer func() {
-			err := us.Delete(jon.ID)
-			if err != nil {
-				t.Errorf("us.Delete() err = %s", err)
-			}
-		}()
 
 		tests := []struct {
 			name    string
@@ -126,6 +76,43 @@ func testUserStore_Find(us *UserStore) func(t *testing.T) {
 	}
 }
 
+func TestUserStore_Where(t *testing.T) {
+	us := userStore(t)
+	store := fixtureStore(us)
+	jon := fixtures.NewUser().WithName("Jon Calhoun").WithEmail("jon@calhoun.io").Create(t, store)
+	jonny := fixtures.NewUser().WithName("Jonny Appleseed").WithEmail("jonny@example.com").Create(t, store)
+	bob := fixtures.NewUser().WithName("Bob Smith").WithEmail("bob@CALHOUN.io").Create(t, store)
+
+	tests := map[string]struct {
+		filter UserFilter
+		want   []int
+	}{
+		"everyone":     {UserFilter{}, []int{jon.ID, jonny.ID, bob.ID}},
+		"name prefix":  {UserFilter{NamePrefix: "Jon"}, []int{jon.ID, jonny.ID}},
+		"email domain": {UserFilter{EmailDomain: "calhoun.io"}, []int{jon.ID, bob.ID}},
+		"ids":          {UserFilter{IDs: []int{bob.ID, jonny.ID}}, []int{jonny.ID, bob.ID}},
+		"no ids":       {UserFilter{IDs: []int{}}, nil},
+		"combined":     {UserFilter{NamePrefix: "Jon", EmailDomain: "calhoun.io"}, []int{jon.ID}},
+		"limit":        {UserFilter{Limit: 2}, []int{jon.ID, jonny.ID}},
+		"no matches":   {UserFilter{NamePrefix: "Jon%"}, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			users, err := us.Where(tc.filter)
+			if err != nil {
+				t.Fatalf("us.Where() err = %s", err)
+			}
+			var got []int
+			for _, user := range users {
+				got = append(got, user.ID)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("us.Where() ids = %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
 // func newServer(t *testing.T) (*httptest.Server, func()) {
 // 	t.Helper()
 // 	db := ...
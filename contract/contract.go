@@ -0,0 +1,110 @@
+// Package contract provides a small framework for writing contract tests:
+// a set of tests that any implementation of an interface should pass.
+//
+// Contract tests are written once, usually alongside the interface, as a
+// list of Tests. Each implementation then runs them with a Suite that
+// describes how to create a fresh implementation for every test, any
+// setup or teardown it needs, and which optional capabilities it doesn't
+// support.
+//
+// Tests receive the implementation as an interface{}, so packages
+// providing contract tests typically wrap this package with a typed API.
+// See the suite/suitetest package for an example.
+package contract
+
+import (
+	"testing"
+)
+
+// Capability is an optional behavior of an implementation. Tests that
+// require a capability are skipped for implementations that list it in
+// Suite.Skip.
+type Capability string
+
+// Test is a single contract test.
+type Test struct {
+	Name string
+	// Requires lists the optional capabilities the test depends on.
+	Requires []Capability
+	// Fn runs the test against impl, which is the value returned by
+	// Suite.New.
+	Fn func(t *testing.T, impl interface{})
+}
+
+// Suite runs contract tests against one implementation.
+type Suite struct {
+	// New returns the implementation to test. It is called once for every
+	// test so that tests can't interfere with one another. It may return
+	// the same value each time if the implementation can't be recreated,
+	// but then the tests can't be run in parallel unless it is safe for
+	// concurrent use.
+	New func(t *testing.T) interface{}
+
+	// Setup and Teardown are called once before and after all of the tests
+	// in the suite have run.
+	Setup    func(t *testing.T)
+	Teardown func(t *testing.T)
+
+	// BeforeEach and AfterEach are called before and after every test with
+	// the implementation being tested. AfterEach runs even if the test
+	// fails.
+	BeforeEach func(t *testing.T, impl interface{})
+	AfterEach  func(t *testing.T, impl interface{})
+
+	// Skip lists the optional capabilities the implementation doesn't
+	// support.
+	Skip []Capability
+
+	// Parallel runs the tests in parallel with one another.
+	Parallel bool
+}
+
+// Run runs each of the tests as a subtest of t.
+func (s *Suite) Run(t *testing.T, tests []Test) {
+	t.Helper()
+	if s.New == nil {
+		t.Fatalf("contract: Suite.New is required")
+	}
+	if s.Setup != nil {
+		s.Setup(t)
+	}
+	if s.Teardown != nil {
+		// Cleanup functions run after all subtests, including parallel
+		// ones, have completed.
+		t.Cleanup(func() {
+			s.Teardown(t)
+		})
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			for _, c := range test.Requires {
+				if s.skips(c) {
+					t.Skipf("implementation does not support %s", c)
+				}
+			}
+			if s.Parallel {
+				t.Parallel()
+			}
+			impl := s.New(t)
+			if s.BeforeEach != nil {
+				s.BeforeEach(t, impl)
+			}
+			if s.AfterEach != nil {
+				t.Cleanup(func() {
+					s.AfterEach(t, impl)
+				})
+			}
+			test.Fn(t, impl)
+		})
+	}
+}
+
+func (s *Suite) skips(c Capability) bool {
+	for _, skip := range s.Skip {
+		if skip == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package contract_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/joncalhoun/twg/contract"
+)
+
+// counter is a toy interface used to test the framework.
+type counter interface {
+	Inc() int
+}
+
+type memCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *memCounter) Inc() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return c.n
+}
+
+func TestSuite_Run(t *testing.T) {
+	var events []string
+	record := func(event string) {
+		events = append(events, event)
+	}
+	s := contract.Suite{
+		New: func(t *testing.T) interface{} {
+			record("new")
+			return &memCounter{}
+		},
+		Setup:    func(t *testing.T) { record("setup") },
+		Teardown: func(t *testing.T) { record("teardown") },
+		BeforeEach: func(t *testing.T, impl interface{}) {
+			record("before")
+		},
+		AfterEach: func(t *testing.T, impl interface{}) {
+			record("after")
+		},
+		Skip: []contract.Capability{"decrement"},
+	}
+	tests := []contract.Test{
+		{
+			Name: "fresh implementation",
+			Fn: func(t *testing.T, impl interface{}) {
+				record("test")
+				if got := impl.(counter).Inc(); got != 1 {
+					t.Errorf("Inc() = %d; want %d", got, 1)
+				}
+			},
+		},
+		{
+			Name: "another fresh implementation",
+			Fn: func(t *testing.T, impl interface{}) {
+				record("test")
+				if got := impl.(counter).Inc(); got != 1 {
+					t.Errorf("Inc() = %d; want %d", got, 1)
+				}
+			},
+		},
+		{
+			Name:     "skipped",
+			Requires: []contract.Capability{"decrement"},
+			Fn: func(t *testing.T, impl interface{}) {
+				t.Errorf("test requiring a skipped capability was run")
+			},
+		},
+	}
+	t.Run("suite", func(t *testing.T) {
+		s.Run(t, tests)
+	})
+
+	want := []string{
+		"setup",
+		"new", "before", "test", "after",
+		"new", "before", "test", "after",
+		"teardown",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v; want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %v; want %v", events, want)
+		}
+	}
+}
+
+func TestSuite_Run_parallel(t *testing.T) {
+	shared := &memCounter{}
+	var mu sync.Mutex
+	returned := false
+	const n = 5
+	s := contract.Suite{
+		New: func(t *testing.T) interface{} {
+			return shared
+		},
+		Parallel: true,
+		Teardown: func(t *testing.T) {
+			if got := shared.Inc(); got != n+1 {
+				t.Errorf("Teardown ran before all tests completed; Inc() = %d; want %d", got, n+1)
+			}
+		},
+	}
+	var tests []contract.Test
+	for i := 0; i < n; i++ {
+		tests = append(tests, contract.Test{
+			Name: "test",
+			Fn: func(t *testing.T, impl interface{}) {
+				// Parallel subtests don't start until their parent's
+				// function has returned.
+				mu.Lock()
+				if !returned {
+					t.Errorf("test ran before Run returned; want it to run in parallel")
+				}
+				mu.Unlock()
+				impl.(counter).Inc()
+			},
+		})
+	}
+	t.Run("suite", func(t *testing.T) {
+		s.Run(t, tests)
+		mu.Lock()
+		returned = true
+		mu.Unlock()
+	})
+}
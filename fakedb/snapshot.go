@@ -0,0 +1,158 @@
+package fakedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Snapshot is a copy of the contents of a UserDB at a point in time. It
+// can be encoded as JSON.
+type Snapshot struct {
+	Users  []User `json:"users"`
+	NextID int    `json:"next_id"`
+}
+
+// Snapshot returns a copy of the current contents of the UserDB. Users
+// are ordered by ID. Latency and failures set with SetLatency and
+// FailNext do not apply.
+func (udb *UserDB) Snapshot() Snapshot {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	s := Snapshot{
+		Users:  make([]User, 0, len(udb.users)),
+		NextID: udb.nextID,
+	}
+	for _, user := range udb.users {
+		s.Users = append(s.Users, user)
+	}
+	sort.Slice(s.Users, func(i, j int) bool {
+		return s.Users[i].ID < s.Users[j].ID
+	})
+	return s
+}
+
+// Restore replaces the contents of the UserDB with the snapshot. An error
+// is returned and the UserDB is left unchanged if the snapshot contains
+// duplicate IDs or email addresses.
+func (udb *UserDB) Restore(s Snapshot) error {
+	users := make(map[int]User, len(s.Users))
+	store := make(map[string]int, len(s.Users))
+	nextID := s.NextID
+	for _, user := range s.Users {
+		if _, ok := users[user.ID]; ok {
+			return fmt.Errorf("fakedb: snapshot has more than one user with the ID %d", user.ID)
+		}
+		if id, ok := store[user.Email]; ok {
+			return fmt.Errorf("%w: %s is used by the users with the IDs %d and %d", ErrEmailTaken, user.Email, id, user.ID)
+		}
+		users[user.ID] = user
+		store[user.Email] = user.ID
+		if user.ID >= nextID {
+			nextID = user.ID + 1
+		}
+	}
+	if nextID < 1 {
+		nextID = 1
+	}
+
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	udb.users = users
+	udb.store = store
+	udb.nextID = nextID
+	return nil
+}
+
+// Dump writes the contents of the UserDB to w as JSON:
+//
+//	{"users": [{"id": 1, "email": "jon@calhoun.io"}], "next_id": 2}
+func (udb *UserDB) Dump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(udb.Snapshot())
+}
+
+// Load replaces the contents of the UserDB with JSON written by Dump.
+func (udb *UserDB) Load(r io.Reader) error {
+	var s Snapshot
+	err := json.NewDecoder(r).Decode(&s)
+	if err != nil {
+		return fmt.Errorf("fakedb: decoding snapshot: %w", err)
+	}
+	return udb.Restore(s)
+}
+
+// Change is a user that exists in two snapshots with different values.
+type Change struct {
+	Before, After User
+}
+
+// Diff describes how the users in one snapshot differ from another.
+type Diff struct {
+	Added   []User
+	Changed []Change
+	Removed []User
+}
+
+// Diff returns the users that were added, changed or removed between s
+// and later. Each list is ordered by ID.
+func (s Snapshot) Diff(later Snapshot) Diff {
+	before := make(map[int]User, len(s.Users))
+	for _, user := range s.Users {
+		before[user.ID] = user
+	}
+	after := make(map[int]User, len(later.Users))
+	for _, user := range later.Users {
+		after[user.ID] = user
+	}
+
+	var d Diff
+	for id, a := range after {
+		b, ok := before[id]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, a)
+		case a != b:
+			d.Changed = append(d.Changed, Change{Before: b, After: a})
+		}
+	}
+	for id, b := range before {
+		if _, ok := after[id]; !ok {
+			d.Removed = append(d.Removed, b)
+		}
+	}
+	sort.Slice(d.Added, func(i, j int) bool {
+		return d.Added[i].ID < d.Added[j].ID
+	})
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].Before.ID < d.Changed[j].Before.ID
+	})
+	sort.Slice(d.Removed, func(i, j int) bool {
+		return d.Removed[i].ID < d.Removed[j].ID
+	})
+	return d
+}
+
+// Empty reports whether the snapshots had the same users.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// String returns the diff with one line per user, prefixed with + for
+// added users, ~ for changed users and - for removed users.
+func (d Diff) String() string {
+	var sb strings.Builder
+	for _, user := range d.Added {
+		fmt.Fprintf(&sb, "+ %+v\n", user)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&sb, "~ %+v -> %+v\n", c.Before, c.After)
+	}
+	for _, user := range d.Removed {
+		fmt.Fprintf(&sb, "- %+v\n", user)
+	}
+	return sb.String()
+}
@@ -0,0 +1,171 @@
+package fakedb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/joncalhoun/twg/fakedb"
+)
+
+func seed(t *testing.T, udb *fakedb.UserDB, emails ...string) []*fakedb.User {
+	t.Helper()
+	var users []*fakedb.User
+	for _, email := range emails {
+		user := &fakedb.User{Email: email}
+		if err := udb.Create(user); err != nil {
+			t.Fatalf("Create() err = %s; want nil", err)
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+func TestUserDB_SnapshotRestore(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	seed(t, udb, "jon@calhoun.io", "bob@example.com")
+	snap := udb.Snapshot()
+
+	t.Run("subtest changing state", func(t *testing.T) {
+		defer func() {
+			if err := udb.Restore(snap); err != nil {
+				t.Fatalf("Restore() err = %s; want nil", err)
+			}
+		}()
+		seed(t, udb, "alice@example.com")
+		if err := udb.Delete(1); err != nil {
+			t.Fatalf("Delete() err = %s; want nil", err)
+		}
+	})
+
+	got := udb.Snapshot()
+	if !reflect.DeepEqual(got, snap) {
+		t.Errorf("Snapshot() after Restore() = %+v; want %+v", got, snap)
+	}
+	if _, err := udb.FindByEmail("jon@calhoun.io"); err != nil {
+		t.Errorf("FindByEmail() after Restore() err = %s; want nil", err)
+	}
+	// IDs handed out before the restore may be reused, but IDs in the
+	// snapshot must not be.
+	user := seed(t, udb, "alice@example.com")[0]
+	if user.ID != 3 {
+		t.Errorf("Create() after Restore() user.ID = %d; want %d", user.ID, 3)
+	}
+}
+
+func TestUserDB_Restore_invalid(t *testing.T) {
+	tests := map[string]struct {
+		snap fakedb.Snapshot
+		want error
+	}{
+		"duplicate email": {
+			snap: fakedb.Snapshot{Users: []fakedb.User{
+				{ID: 1, Email: "jon@calhoun.io"},
+				{ID: 2, Email: "jon@calhoun.io"},
+			}},
+			want: fakedb.ErrEmailTaken,
+		},
+		"duplicate ID": {
+			snap: fakedb.Snapshot{Users: []fakedb.User{
+				{ID: 1, Email: "jon@calhoun.io"},
+				{ID: 1, Email: "bob@example.com"},
+			}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			udb := fakedb.NewUserDB()
+			seed(t, udb, "alice@example.com")
+			before := udb.Snapshot()
+			err := udb.Restore(tc.snap)
+			if err == nil {
+				t.Fatalf("Restore() err = nil; want an error")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("Restore() err = %v; want %v", err, tc.want)
+			}
+			if d := before.Diff(udb.Snapshot()); !d.Empty() {
+				t.Errorf("Restore() changed the UserDB after failing:\n%s", d)
+			}
+		})
+	}
+}
+
+func TestUserDB_DumpLoad(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	seed(t, udb, "jon@calhoun.io", "bob@example.com")
+	var buf bytes.Buffer
+	err := udb.Dump(&buf)
+	if err != nil {
+		t.Fatalf("Dump() err = %s; want nil", err)
+	}
+
+	var dumped map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &dumped); err != nil {
+		t.Fatalf("Unmarshal() err = %s; want nil", err)
+	}
+	wantDump := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": 1.0, "email": "jon@calhoun.io"},
+			map[string]interface{}{"id": 2.0, "email": "bob@example.com"},
+		},
+		"next_id": 3.0,
+	}
+	if !reflect.DeepEqual(dumped, wantDump) {
+		t.Errorf("Dump() = %s; want %v", buf.String(), wantDump)
+	}
+
+	loaded := fakedb.NewUserDB()
+	err = loaded.Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() err = %s; want nil", err)
+	}
+	if got, want := loaded.Snapshot(), udb.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() after Load() = %+v; want %+v", got, want)
+	}
+
+	err = loaded.Load(bytes.NewBufferString("not json"))
+	if err == nil {
+		t.Errorf("Load(invalid) err = nil; want an error")
+	}
+}
+
+func TestSnapshot_Diff(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	users := seed(t, udb, "jon@calhoun.io", "bob@example.com", "alice@example.com")
+	before := udb.Snapshot()
+
+	if err := udb.Delete(users[1].ID); err != nil {
+		t.Fatalf("Delete() err = %s; want nil", err)
+	}
+	changed := fakedb.User{ID: users[2].ID, Email: "alice@calhoun.io"}
+	if err := udb.Update(&changed); err != nil {
+		t.Fatalf("Update() err = %s; want nil", err)
+	}
+	added := seed(t, udb, "sue@example.com")[0]
+
+	got := before.Diff(udb.Snapshot())
+	want := fakedb.Diff{
+		Added:   []fakedb.User{*added},
+		Changed: []fakedb.Change{{Before: *users[2], After: changed}},
+		Removed: []fakedb.User{*users[1]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v; want %+v", got, want)
+	}
+	if got.Empty() {
+		t.Errorf("Empty() = true; want false")
+	}
+	wantStr := "+ {ID:4 Email:sue@example.com}\n" +
+		"~ {ID:3 Email:alice@example.com} -> {ID:3 Email:alice@calhoun.io}\n" +
+		"- {ID:2 Email:bob@example.com}\n"
+	if got.String() != wantStr {
+		t.Errorf("String() = %q; want %q", got.String(), wantStr)
+	}
+
+	if d := before.Diff(before); !d.Empty() {
+		t.Errorf("Diff() of identical snapshots = %+v; want an empty Diff", d)
+	}
+}
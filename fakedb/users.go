@@ -3,44 +3,172 @@ package fakedb
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 )
 
 var (
-	ErrNotFound = errors.New("fakedb: resource could not be located")
+	ErrNotFound   = errors.New("fakedb: resource could not be located")
+	ErrEmailTaken = errors.New("fakedb: email address is taken")
+	// ErrInjected is returned by calls that fail because of FailNext when
+	// no other error was provided.
+	ErrInjected = errors.New("fakedb: injected failure")
 )
 
 type User struct {
-	ID    int
-	Email string
+	ID    int    `json:"id"`
+	Email string `json:"email"`
 }
 
 func NewUserDB() *UserDB {
 	return &UserDB{
-		store:  make(map[string]int, 0),
+		users:  make(map[int]User),
+		store:  make(map[string]int),
 		nextID: 1,
 	}
 }
 
+// UserDB is an in-memory fake of a user database. It is safe for
+// concurrent use.
 type UserDB struct {
-	store  map[string]int
+	mu     sync.Mutex
+	users  map[int]User
+	store  map[string]int // email -> ID
 	nextID int
+
+	failN   int
+	failErr error
+	latency time.Duration
+}
+
+// FailNext causes the next n calls to the UserDB to return err without
+// doing anything. If err is nil, ErrInjected is returned instead.
+func (udb *UserDB) FailNext(n int, err error) {
+	if err == nil {
+		err = ErrInjected
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	udb.failN = n
+	udb.failErr = err
+}
+
+// SetLatency causes every call to the UserDB to wait for d before doing
+// anything. Calls wait independently of one another.
+func (udb *UserDB) SetLatency(d time.Duration) {
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	udb.latency = d
+}
+
+// fault applies any latency or failures set with SetLatency and FailNext.
+func (udb *UserDB) fault() error {
+	udb.mu.Lock()
+	latency := udb.latency
+	var err error
+	if udb.failN > 0 {
+		udb.failN--
+		err = udb.failErr
+	}
+	udb.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return err
 }
 
 func (udb *UserDB) Create(user *User) error {
+	if err := udb.fault(); err != nil {
+		return err
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
 	if id, ok := udb.store[user.Email]; ok {
-		return fmt.Errorf("Email %s is taken by the user with the ID: %d", user.Email, id)
+		return fmt.Errorf("%w: %s is used by the user with the ID %d", ErrEmailTaken, user.Email, id)
 	}
 	user.ID = udb.nextID
 	udb.nextID++
+	udb.users[user.ID] = *user
+	udb.store[user.Email] = user.ID
 	return nil
 }
 
+func (udb *UserDB) FindByID(id int) (*User, error) {
+	if err := udb.fault(); err != nil {
+		return nil, err
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	user, ok := udb.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
 func (udb *UserDB) FindByEmail(email string) (*User, error) {
-	if id, ok := udb.store[email]; ok {
-		return &User{
-			ID:    id,
-			Email: email,
-		}, nil
+	if err := udb.fault(); err != nil {
+		return nil, err
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	id, ok := udb.store[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := udb.users[id]
+	return &user, nil
+}
+
+// Update replaces the user with the same ID as user.
+func (udb *UserDB) Update(user *User) error {
+	if err := udb.fault(); err != nil {
+		return err
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	existing, ok := udb.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if id, ok := udb.store[user.Email]; ok && id != user.ID {
+		return fmt.Errorf("%w: %s is used by the user with the ID %d", ErrEmailTaken, user.Email, id)
+	}
+	delete(udb.store, existing.Email)
+	udb.users[user.ID] = *user
+	udb.store[user.Email] = user.ID
+	return nil
+}
+
+func (udb *UserDB) Delete(id int) error {
+	if err := udb.fault(); err != nil {
+		return err
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	user, ok := udb.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(udb.users, id)
+	delete(udb.store, user.Email)
+	return nil
+}
+
+// List returns every user ordered by ID.
+func (udb *UserDB) List() ([]User, error) {
+	if err := udb.fault(); err != nil {
+		return nil, err
+	}
+	udb.mu.Lock()
+	defer udb.mu.Unlock()
+	users := make([]User, 0, len(udb.users))
+	for _, user := range udb.users {
+		users = append(users, user)
 	}
-	return nil, ErrNotFound
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
 }
@@ -0,0 +1,207 @@
+package fakedb_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/twg/fakedb"
+)
+
+func TestUserDB_Create(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	user := &fakedb.User{Email: "jon@calhoun.io"}
+	err := udb.Create(user)
+	if err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	if user.ID <= 0 {
+		t.Errorf("Create() user.ID = %d; want a positive value", user.ID)
+	}
+
+	got, err := udb.FindByEmail(user.Email)
+	if err != nil {
+		t.Fatalf("FindByEmail() err = %s; want nil", err)
+	}
+	if *got != *user {
+		t.Errorf("FindByEmail() = %+v; want %+v", got, user)
+	}
+	got, err = udb.FindByID(user.ID)
+	if err != nil {
+		t.Fatalf("FindByID() err = %s; want nil", err)
+	}
+	if *got != *user {
+		t.Errorf("FindByID() = %+v; want %+v", got, user)
+	}
+
+	err = udb.Create(&fakedb.User{Email: user.Email})
+	if !errors.Is(err, fakedb.ErrEmailTaken) {
+		t.Errorf("Create() with a taken email err = %v; want %v", err, fakedb.ErrEmailTaken)
+	}
+}
+
+func TestUserDB_Find_notFound(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	_, err := udb.FindByID(1)
+	if err != fakedb.ErrNotFound {
+		t.Errorf("FindByID() err = %v; want %v", err, fakedb.ErrNotFound)
+	}
+	_, err = udb.FindByEmail("jon@calhoun.io")
+	if err != fakedb.ErrNotFound {
+		t.Errorf("FindByEmail() err = %v; want %v", err, fakedb.ErrNotFound)
+	}
+}
+
+func TestUserDB_Update(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	jon := &fakedb.User{Email: "jon@calhoun.io"}
+	bob := &fakedb.User{Email: "bob@example.com"}
+	for _, user := range []*fakedb.User{jon, bob} {
+		if err := udb.Create(user); err != nil {
+			t.Fatalf("Create() err = %s; want nil", err)
+		}
+	}
+
+	jon.Email = "jon@example.com"
+	err := udb.Update(jon)
+	if err != nil {
+		t.Fatalf("Update() err = %s; want nil", err)
+	}
+	got, err := udb.FindByEmail("jon@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail() err = %s; want nil", err)
+	}
+	if *got != *jon {
+		t.Errorf("FindByEmail() = %+v; want %+v", got, jon)
+	}
+	_, err = udb.FindByEmail("jon@calhoun.io")
+	if err != fakedb.ErrNotFound {
+		t.Errorf("FindByEmail(old email) err = %v; want %v", err, fakedb.ErrNotFound)
+	}
+
+	err = udb.Update(&fakedb.User{ID: jon.ID, Email: bob.Email})
+	if !errors.Is(err, fakedb.ErrEmailTaken) {
+		t.Errorf("Update() with a taken email err = %v; want %v", err, fakedb.ErrEmailTaken)
+	}
+	err = udb.Update(&fakedb.User{ID: 123, Email: "new@example.com"})
+	if err != fakedb.ErrNotFound {
+		t.Errorf("Update() missing user err = %v; want %v", err, fakedb.ErrNotFound)
+	}
+}
+
+func TestUserDB_Delete(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	user := &fakedb.User{Email: "jon@calhoun.io"}
+	if err := udb.Create(user); err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	err := udb.Delete(user.ID)
+	if err != nil {
+		t.Fatalf("Delete() err = %s; want nil", err)
+	}
+	_, err = udb.FindByID(user.ID)
+	if err != fakedb.ErrNotFound {
+		t.Errorf("FindByID() after Delete() err = %v; want %v", err, fakedb.ErrNotFound)
+	}
+	err = udb.Delete(user.ID)
+	if err != fakedb.ErrNotFound {
+		t.Errorf("Delete() twice err = %v; want %v", err, fakedb.ErrNotFound)
+	}
+	err = udb.Create(&fakedb.User{Email: user.Email})
+	if err != nil {
+		t.Errorf("Create() with a deleted user's email err = %s; want nil", err)
+	}
+}
+
+func TestUserDB_List(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	var want []fakedb.User
+	for i := 0; i < 5; i++ {
+		user := &fakedb.User{Email: fmt.Sprintf("user%d@example.com", i)}
+		if err := udb.Create(user); err != nil {
+			t.Fatalf("Create() err = %s; want nil", err)
+		}
+		want = append(want, *user)
+	}
+	got, err := udb.List()
+	if err != nil {
+		t.Fatalf("List() err = %s; want nil", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v; want %v", got, want)
+	}
+}
+
+func TestUserDB_concurrent(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := &fakedb.User{Email: fmt.Sprintf("user%d@example.com", i)}
+			if err := udb.Create(user); err != nil {
+				t.Errorf("Create() err = %s; want nil", err)
+				return
+			}
+			user.Email = fmt.Sprintf("updated%d@example.com", i)
+			if err := udb.Update(user); err != nil {
+				t.Errorf("Update() err = %s; want nil", err)
+			}
+			if _, err := udb.List(); err != nil {
+				t.Errorf("List() err = %s; want nil", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	users, err := udb.List()
+	if err != nil {
+		t.Fatalf("List() err = %s; want nil", err)
+	}
+	if len(users) != n {
+		t.Errorf("len(List()) = %d; want %d", len(users), n)
+	}
+}
+
+func TestUserDB_FailNext(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	custom := errors.New("connection reset")
+	tests := map[string]struct {
+		err  error
+		want error
+	}{
+		"default error": {nil, fakedb.ErrInjected},
+		"custom error":  {custom, custom},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			udb.FailNext(2, tc.err)
+			for i := 0; i < 2; i++ {
+				err := udb.Create(&fakedb.User{Email: "jon@calhoun.io"})
+				if err != tc.want {
+					t.Errorf("Create() err = %v; want %v", err, tc.want)
+				}
+			}
+			user := &fakedb.User{Email: name + "@example.com"}
+			err := udb.Create(user)
+			if err != nil {
+				t.Errorf("Create() after failures err = %s; want nil", err)
+			}
+		})
+	}
+}
+
+func TestUserDB_SetLatency(t *testing.T) {
+	udb := fakedb.NewUserDB()
+	const latency = 50 * time.Millisecond
+	udb.SetLatency(latency)
+	start := time.Now()
+	udb.FindByID(1)
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("FindByID() took %v; want at least %v", elapsed, latency)
+	}
+}
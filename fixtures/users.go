@@ -0,0 +1,177 @@
+// Package fixtures provides builders for creating test data.
+//
+// A typical test will create a user with something like:
+//
+//	user := fixtures.NewUser().WithName("Jon Calhoun").Create(t, store)
+//
+// Any field that isn't set explicitly is filled in with a generated value
+// so that tests only need to specify the fields they actually care about.
+package fixtures
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/joncalhoun/twg/gen"
+)
+
+// User is the data needed to create a user in any of the user stores.
+// Each store has its own User type, so a UserStore is responsible for
+// converting to and from it.
+type User struct {
+	ID      int
+	Name    string
+	Email   string
+	Balance int
+}
+
+// UserStore is the small interface the fixtures package needs to persist
+// users. The psql, builder and race_pass user stores each have their own
+// User type, so tests in those packages use Store to adapt them.
+type UserStore interface {
+	// CreateUser should persist the user and set its ID.
+	CreateUser(user *User) error
+	DeleteUser(id int) error
+}
+
+// Store adapts a user store with its own User type to the UserStore
+// interface. Create converts the User to the store's type and sets the
+// User's ID once the store has assigned one, eg:
+//
+//	store := fixtures.Store{
+//		Create: func(user *fixtures.User) error {
+//			u := &User{Name: user.Name, Email: user.Email}
+//			err := us.Create(u)
+//			user.ID = u.ID
+//			return err
+//		},
+//		Delete: us.Delete,
+//	}
+type Store struct {
+	Create func(user *User) error
+	Delete func(id int) error
+}
+
+func (s Store) CreateUser(user *User) error {
+	return s.Create(user)
+}
+
+func (s Store) DeleteUser(id int) error {
+	return s.Delete(id)
+}
+
+// Trait is a reusable set of changes to a UserBuilder, such as giving the
+// user a large balance.
+type Trait func(b *UserBuilder)
+
+// Rich gives the user a large balance.
+func Rich(b *UserBuilder) {
+	b.user.Balance = 1000000
+}
+
+// Broke gives the user a balance of zero.
+func Broke(b *UserBuilder) {
+	b.user.Balance = 0
+}
+
+// emails generates the default email address for each user, so that they
+// never collide.
+var emails Sequence
+
+// Sequence generates increasing integers and is safe for concurrent use.
+// It is useful for creating values that must be unique.
+type Sequence struct {
+	mu   sync.Mutex
+	next int
+}
+
+// Next returns the next value in the sequence, starting with 1.
+func (s *Sequence) Next() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	return s.next
+}
+
+// Sprintf formats format using the next value in the sequence, eg
+// seq.Sprintf("user-%d@example.com").
+func (s *Sequence) Sprintf(format string) string {
+	return fmt.Sprintf(format, s.Next())
+}
+
+// UserBuilder builds a User one field at a time. Use NewUser to create
+// one.
+type UserBuilder struct {
+	user     User
+	hasName  bool
+	hasEmail bool
+}
+
+// NewUser returns a UserBuilder with each of the traits applied to it.
+func NewUser(traits ...Trait) *UserBuilder {
+	b := &UserBuilder{}
+	return b.With(traits...)
+}
+
+// With applies each of the traits to the builder.
+func (b *UserBuilder) With(traits ...Trait) *UserBuilder {
+	for _, trait := range traits {
+		trait(b)
+	}
+	return b
+}
+
+// WithName sets the user's name.
+func (b *UserBuilder) WithName(name string) *UserBuilder {
+	b.user.Name = name
+	b.hasName = true
+	return b
+}
+
+// WithEmail sets the user's email address.
+func (b *UserBuilder) WithEmail(email string) *UserBuilder {
+	b.user.Email = email
+	b.hasEmail = true
+	return b
+}
+
+// WithBalance sets the user's balance. Stores that don't track balances
+// will ignore it.
+func (b *UserBuilder) WithBalance(balance int) *UserBuilder {
+	b.user.Balance = balance
+	return b
+}
+
+// Build returns the User without persisting it. A name that was not set
+// is generated using the gen package, and an email address that was not
+// set is numbered so it is unique.
+func (b *UserBuilder) Build() *User {
+	user := b.user
+	if !b.hasName {
+		user.Name = gen.Name()
+	}
+	if !b.hasEmail {
+		user.Email = emails.Sprintf("user-%d@example.com")
+	}
+	return &user
+}
+
+// Create builds the User and persists it using store. The user is deleted
+// via t.Cleanup when the test completes. If the user can't be created the
+// test fails immediately.
+func (b *UserBuilder) Create(t *testing.T, store UserStore) *User {
+	t.Helper()
+	user := b.Build()
+	err := store.CreateUser(user)
+	if err != nil {
+		t.Fatalf("fixtures: CreateUser() err = %s", err)
+	}
+	t.Cleanup(func() {
+		err := store.DeleteUser(user.ID)
+		if err != nil {
+			t.Errorf("fixtures: DeleteUser(%d) err = %s", user.ID, err)
+		}
+	})
+	return user
+}
@@ -0,0 +1,145 @@
+package fixtures_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/twg/fixtures"
+)
+
+type fakeStore struct {
+	users   map[int]fixtures.User
+	nextID  int
+	deleted []int
+}
+
+func (fs *fakeStore) CreateUser(user *fixtures.User) error {
+	fs.nextID++
+	user.ID = fs.nextID
+	fs.users[user.ID] = *user
+	return nil
+}
+
+func (fs *fakeStore) DeleteUser(id int) error {
+	delete(fs.users, id)
+	fs.deleted = append(fs.deleted, id)
+	return nil
+}
+
+func TestUserBuilder_Build(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		a := fixtures.NewUser().Build()
+		b := fixtures.NewUser().Build()
+		if a.Name == "" {
+			t.Errorf("Build().Name = %q; want a generated name", a.Name)
+		}
+		if !strings.HasSuffix(a.Email, "@example.com") {
+			t.Errorf("Build().Email = %q; want a generated email", a.Email)
+		}
+		if a.Email == b.Email {
+			t.Errorf("Build().Email = %q for two users; want unique emails", a.Email)
+		}
+	})
+
+	t.Run("explicit values", func(t *testing.T) {
+		got := fixtures.NewUser().
+			WithName("Jon Calhoun").
+			WithEmail("jon@calhoun.io").
+			WithBalance(100).
+			Build()
+		want := fixtures.User{
+			Name:    "Jon Calhoun",
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		if *got != want {
+			t.Errorf("Build() = %+v; want %+v", *got, want)
+		}
+	})
+
+	t.Run("empty values are kept", func(t *testing.T) {
+		got := fixtures.NewUser().WithName("").Build()
+		if got.Name != "" {
+			t.Errorf("Build().Name = %q; want %q", got.Name, "")
+		}
+	})
+
+	t.Run("traits", func(t *testing.T) {
+		got := fixtures.NewUser(fixtures.Rich).Build()
+		if got.Balance <= 0 {
+			t.Errorf("NewUser(Rich).Build().Balance = %d; want a positive value", got.Balance)
+		}
+		got = fixtures.NewUser(fixtures.Rich).With(fixtures.Broke).Build()
+		if got.Balance != 0 {
+			t.Errorf("NewUser(Rich).With(Broke).Build().Balance = %d; want %d", got.Balance, 0)
+		}
+		admin := func(b *fixtures.UserBuilder) {
+			b.WithName("Admin").WithEmail("admin@example.com")
+		}
+		got = fixtures.NewUser(admin).Build()
+		if got.Name != "Admin" || got.Email != "admin@example.com" {
+			t.Errorf("NewUser(admin).Build() = %+v; want the admin name and email", *got)
+		}
+	})
+}
+
+func TestUserBuilder_Create(t *testing.T) {
+	store := &fakeStore{
+		users: make(map[int]fixtures.User),
+	}
+	t.Run("persists and cleans up", func(t *testing.T) {
+		user := fixtures.NewUser().WithName("Jon Calhoun").Create(t, store)
+		if user.ID <= 0 {
+			t.Errorf("Create().ID = %d; want a positive value", user.ID)
+		}
+		if got := store.users[user.ID]; got != *user {
+			t.Errorf("store.users[%d] = %+v; want %+v", user.ID, got, *user)
+		}
+	})
+	if len(store.users) != 0 {
+		t.Errorf("len(store.users) = %d after cleanup; want %d", len(store.users), 0)
+	}
+	if len(store.deleted) != 1 {
+		t.Errorf("len(store.deleted) = %d; want %d", len(store.deleted), 1)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var seq fixtures.Sequence
+	if got := seq.Next(); got != 1 {
+		t.Errorf("Next() = %d; want %d", got, 1)
+	}
+	if got := seq.Sprintf("user-%d@example.com"); got != "user-2@example.com" {
+		t.Errorf("Sprintf() = %q; want %q", got, "user-2@example.com")
+	}
+}
+
+func TestStore(t *testing.T) {
+	var created []fixtures.User
+	var deleted []int
+	store := fixtures.Store{
+		Create: func(user *fixtures.User) error {
+			user.ID = 7
+			created = append(created, *user)
+			return nil
+		},
+		Delete: func(id int) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+	t.Run("create", func(t *testing.T) {
+		user := fixtures.NewUser().WithName("Jon Calhoun").WithEmail("jon@calhoun.io").Create(t, store)
+		want := fixtures.User{ID: 7, Name: "Jon Calhoun", Email: "jon@calhoun.io"}
+		if *user != want {
+			t.Errorf("Create() = %+v; want %+v", *user, want)
+		}
+	})
+	if !reflect.DeepEqual(created, []fixtures.User{{ID: 7, Name: "Jon Calhoun", Email: "jon@calhoun.io"}}) {
+		t.Errorf("created = %+v; want the user", created)
+	}
+	if !reflect.DeepEqual(deleted, []int{7}) {
+		t.Errorf("deleted = %v; want %v", deleted, []int{7})
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"html/template"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/joncalhoun/twg/form"
+	"github.com/joncalhoun/twg/htmltest"
 )
 
 var updateFlag bool
@@ -115,6 +117,47 @@ func TestHTML(t *testing.T) {
 	}
 }
 
+// TestHTML_fields checks the structure of the generated HTML, so it
+// doesn't depend on the whitespace recorded in the golden files.
+func TestHTML_fields(t *testing.T) {
+	strct := struct {
+		Email    string `form:"label=Email Address;placeholder=you@domain.com;type=email;name=EmailAddress"`
+		Password string `form:"type=password"`
+		Nested   struct {
+			Age int
+		}
+	}{
+		Email:    "email@taken.com",
+		Password: "badpw",
+	}
+	got, err := form.HTML(tplErrors, strct,
+		form.FieldError{Field: "EmailAddress", Error: "Email address is already taken"},
+		form.FieldError{Field: "Password", Error: "Password must be a palindrome"},
+		form.FieldError{Field: "Password", Error: "Password must contain an emoji"},
+	)
+	if err != nil {
+		t.Fatalf("HTML() err = %s; want nil", err)
+	}
+	doc := htmltest.Parse(t, string(got))
+	doc.TextEquals("label", "Email Address", "Password", "Age").
+		CountIs("input.border-red", 2).
+		HasElement("input[name=EmailAddress][placeholder='you@domain.com']").
+		TextEquals("p.text-red",
+			"Email address is already taken",
+			"Password must be a palindrome",
+			"Password must contain an emoji",
+		)
+
+	want := []htmltest.Field{
+		{Tag: "input", Name: "EmailAddress", Type: "email", Value: "email@taken.com"},
+		{Tag: "input", Name: "Password", Type: "password", Value: "badpw"},
+		{Tag: "input", Name: "Nested.Age", Type: "text"},
+	}
+	if fields := doc.Fields(); !reflect.DeepEqual(fields, want) {
+		t.Errorf("Fields() = %+v; want %+v", fields, want)
+	}
+}
+
 func writeFile(t *testing.T, filename, contents string) {
 	f, err := os.Create(filename)
 	if err != nil {
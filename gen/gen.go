@@ -19,6 +19,14 @@ var firstNames = []string{
 	"Eve",
 }
 
+var lastNames = []string{
+	"Calhoun",
+	"Smith",
+	"Jones",
+	"Garcia",
+	"Nguyen",
+}
+
 // Email generates a unique email address every time it is called. It is
 // intended to be used for creating new user accounts without worrying
 // about an email address already being used.
@@ -33,3 +41,13 @@ func Email() string {
 	count++
 	return ret
 }
+
+// Name generates a random full name. Unlike Email, names are not
+// guaranteed to be unique.
+func Name() string {
+	m.Lock()
+	defer m.Unlock()
+	first := firstNames[rand.Intn(len(firstNames))]
+	last := lastNames[rand.Intn(len(lastNames))]
+	return fmt.Sprintf("%s %s", first, last)
+}
@@ -66,7 +66,6 @@ func headerAuthMw(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		next(w, r)
-		next(w, r)
 	}
 }
 
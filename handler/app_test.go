@@ -6,7 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
-	"github.com/joncalhoun/twg/app"
+	app "github.com/joncalhoun/twg/handler"
+	"github.com/joncalhoun/twg/httpassert"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -91,3 +92,61 @@ func TestApp(t *testing.T) {
 		}
 	})
 }
+
+func TestServer(t *testing.T) {
+	h := httpassert.Harness{Handler: &app.Server{}}
+	const (
+		home  = "<h1>Welcome!</h1>"
+		admin = "<h1>Welcome to the admin page!</h1>"
+	)
+
+	h.Get(t, "/").
+		Status(http.StatusOK).
+		BodyEquals(home)
+
+	res := h.Do(t, httptest.NewRequest(http.MethodPost, "/login", nil)).
+		Redirect(http.StatusFound, "/")
+	session := res.Cookie("session", "fake_session_token")
+
+	withCookie := func(c *http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		return r
+	}
+	withKey := func(key string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/header-admin", nil)
+		if key != "" {
+			r.Header.Set("api-key", key)
+		}
+		return r
+	}
+
+	cookieForAPI := withKey("")
+	cookieForAPI.AddCookie(session)
+
+	tests := map[string]struct {
+		req      *http.Request
+		wantCode int
+		wantBody string
+	}{
+		"cookie":         {withCookie(session), http.StatusOK, admin},
+		"no cookie":      {withCookie(nil), http.StatusForbidden, ""},
+		"bad cookie":     {withCookie(&http.Cookie{Name: "session", Value: "fake"}), http.StatusForbidden, ""},
+		"api key":        {withKey("fake_api_key"), http.StatusOK, admin},
+		"no api key":     {withKey(""), http.StatusForbidden, ""},
+		"bad api key":    {withKey("fake"), http.StatusForbidden, ""},
+		"cookie for api": {cookieForAPI, http.StatusForbidden, ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := h.Do(t, tc.req)
+			if tc.wantCode == http.StatusOK {
+				res.Status(http.StatusOK).BodyEquals(tc.wantBody)
+				return
+			}
+			res.Redirect(tc.wantCode, "/")
+		})
+	}
+}
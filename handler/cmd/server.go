@@ -1,11 +1,27 @@
 package main
 
 import (
-	"net/http"
+	"context"
+	"flag"
+	"fmt"
+	"os"
 
 	"github.com/joncalhoun/twg/app"
 )
 
 func main() {
-	http.ListenAndServe(":3000", &app.Server{})
+	cfg, err := app.ParseConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Printf("Listening on %s\n", cfg.Addr)
+	err = app.Run(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
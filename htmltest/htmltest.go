@@ -0,0 +1,274 @@
+// Package htmltest queries and makes assertions about HTML in tests.
+//
+//	doc := htmltest.Parse(t, body)
+//	doc.CountIs("div.alert", 2)
+//	doc.TextEquals("div.alert", "Alert Number 1", "Alert Number 2")
+//	token := doc.Forms()[0].Values().Get("csrf_token")
+//
+// Elements are found with a subset of CSS selectors; see Selector.
+package htmltest
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// T is the subset of testing.TB used by this package.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Doc is a parsed HTML document or fragment. Its assertions report
+// failures to the T it was parsed with.
+type Doc struct {
+	Element
+}
+
+// Parse parses body. Fragments are parsed as a full document would be, so
+// html, head and body elements are added as needed.
+func Parse(t T, body string) *Doc {
+	t.Helper()
+	root, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		// html.Parse only fails if reading fails, which can't happen with
+		// a strings.Reader, but report it rather than panic later.
+		t.Errorf("htmltest: html.Parse() err = %s", err)
+		root = &html.Node{Type: html.DocumentNode}
+	}
+	return &Doc{Element{Node: root, t: t}}
+}
+
+// Element is an HTML element found by a query.
+type Element struct {
+	*html.Node
+	t T
+}
+
+// Attr returns the value of the attribute and whether it is set.
+func (e *Element) Attr(key string) (string, bool) {
+	return attr(e.Node, key)
+}
+
+// Text returns the text inside the element, including the text of nested
+// elements, with runs of whitespace collapsed to a single space.
+func (e *Element) Text() string {
+	return Text(e.Node)
+}
+
+// Text returns the text inside n, including the text of nested elements,
+// with runs of whitespace collapsed to a single space. Like the DOM's
+// textContent, no space is added between elements, and the contents of
+// script and style elements are skipped.
+func Text(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// Find returns every element inside e that matches the selector, in
+// document order. An invalid selector is reported as a test error.
+func (e *Element) Find(sel string) []*Element {
+	e.t.Helper()
+	s, err := Compile(sel)
+	if err != nil {
+		e.t.Errorf("%s", err)
+		return nil
+	}
+	return e.FindSelector(s)
+}
+
+// FindSelector is like Find, but with a compiled selector.
+func (e *Element) FindSelector(s Selector) []*Element {
+	var found []*Element
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if s.matches(c) {
+				found = append(found, &Element{Node: c, t: e.t})
+			}
+			walk(c)
+		}
+	}
+	walk(e.Node)
+	return found
+}
+
+// First returns the first element inside e that matches the selector, or
+// nil if there isn't one.
+func (e *Element) First(sel string) *Element {
+	e.t.Helper()
+	found := e.Find(sel)
+	if len(found) == 0 {
+		return nil
+	}
+	return found[0]
+}
+
+// Texts returns the text of every element matching the selector.
+func (e *Element) Texts(sel string) []string {
+	e.t.Helper()
+	var texts []string
+	for _, el := range e.Find(sel) {
+		texts = append(texts, el.Text())
+	}
+	return texts
+}
+
+// HasElement asserts that at least one element matches the selector.
+func (e *Element) HasElement(sel string) *Element {
+	e.t.Helper()
+	if len(e.Find(sel)) == 0 {
+		e.t.Errorf("htmltest: no elements match %q", sel)
+	}
+	return e
+}
+
+// CountIs asserts that exactly n elements match the selector.
+func (e *Element) CountIs(sel string, n int) *Element {
+	e.t.Helper()
+	if got := len(e.Find(sel)); got != n {
+		e.t.Errorf("htmltest: %d elements match %q; want %d", got, sel, n)
+	}
+	return e
+}
+
+// TextEquals asserts that the elements matching the selector have exactly
+// the texts in want, in order. Text is compared as returned by Text.
+func (e *Element) TextEquals(sel string, want ...string) *Element {
+	e.t.Helper()
+	got := e.Texts(sel)
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		e.t.Errorf("htmltest: text of %q = %q; want %q", sel, got, want)
+	}
+	return e
+}
+
+// Form is a form found by Forms.
+type Form struct {
+	*Element
+	Action string
+	Method string
+	Fields []Field
+}
+
+// Field is an input, select, textarea or button with a name.
+type Field struct {
+	Tag   string
+	Name  string
+	Type  string
+	Value string
+	// Checked is set for checkboxes and radio buttons that are checked.
+	// Values skips those that aren't.
+	Checked bool
+}
+
+// Forms returns every form inside e.
+func (e *Element) Forms() []Form {
+	e.t.Helper()
+	var forms []Form
+	for _, el := range e.Find("form") {
+		action, _ := el.Attr("action")
+		method, _ := el.Attr("method")
+		forms = append(forms, Form{
+			Element: el,
+			Action:  action,
+			Method:  strings.ToUpper(method),
+			Fields:  el.Fields(),
+		})
+	}
+	return forms
+}
+
+// Fields returns every named form field inside e, in document order.
+func (e *Element) Fields() []Field {
+	e.t.Helper()
+	var fields []Field
+	for _, el := range e.Find("input, select, textarea, button") {
+		name, ok := el.Attr("name")
+		if !ok || name == "" {
+			continue
+		}
+		f := Field{Tag: el.Data, Name: name}
+		switch el.Data {
+		case "input":
+			f.Type, _ = el.Attr("type")
+			if f.Type == "" {
+				f.Type = "text"
+			}
+			f.Value, _ = el.Attr("value")
+			_, f.Checked = el.Attr("checked")
+		case "textarea":
+			f.Value = el.Text()
+		case "select":
+			f.Value = selectValue(el)
+		case "button":
+			f.Type, _ = el.Attr("type")
+			f.Value, _ = el.Attr("value")
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// Field returns the first field with the name, and whether there is one.
+func (f Form) Field(name string) (Field, bool) {
+	for _, field := range f.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Values returns the values the form would submit, other than buttons.
+func (f Form) Values() url.Values {
+	values := url.Values{}
+	for _, field := range f.Fields {
+		if field.Tag == "button" || field.Type == "submit" {
+			continue
+		}
+		if (field.Type == "checkbox" || field.Type == "radio") && !field.Checked {
+			continue
+		}
+		values.Add(field.Name, field.Value)
+	}
+	return values
+}
+
+// selectValue returns the value of the selected option, or the first
+// option if none is selected.
+func selectValue(sel *Element) string {
+	options := sel.Find("option")
+	if len(options) == 0 {
+		return ""
+	}
+	chosen := options[0]
+	for _, opt := range options {
+		if _, ok := opt.Attr("selected"); ok {
+			chosen = opt
+			break
+		}
+	}
+	if v, ok := chosen.Attr("value"); ok {
+		return v
+	}
+	return chosen.Text()
+}
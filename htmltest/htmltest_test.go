@@ -0,0 +1,197 @@
+package htmltest_test
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/joncalhoun/twg/htmltest"
+)
+
+// fakeT records errors instead of failing the test.
+type fakeT struct {
+	errors []string
+}
+
+func (ft *fakeT) Helper() {}
+
+func (ft *fakeT) Errorf(format string, args ...interface{}) {
+	ft.errors = append(ft.errors, fmt.Sprintf(format, args...))
+}
+
+const page = `<html>
+<head><title>Test</title><style>.x { color: red }</style></head>
+<body>
+	<div id="main" class="container wide">
+		<div class="alert alert-danger" role="alert">
+			Stuff <b>went</b> wrong!
+		</div>
+		<div class="alert alert-info" role="alert">Heads up</div>
+		<p data-empty="">Paragraph with <a href="/x">a <i>nested</i> link</a>.</p>
+	</div>
+	<div class="footer"><p>Footer</p></div>
+	<form id="login" action="/login" method="post">
+		<input type="hidden" name="csrf_token" value="abc">
+		<input name="email" value="bob@example.com">
+		<input type="checkbox" name="remember" value="yes" checked>
+		<input type="checkbox" name="spam" value="yes">
+		<select name="plan"><option value="free">Free</option><option value="pro" selected>Pro</option></select>
+		<textarea name="bio">Hello
+		world</textarea>
+		<input type="submit" name="go" value="Go">
+		<button type="submit" name="action" value="login">Log in</button>
+		<input value="no name">
+	</form>
+</body>
+</html>`
+
+func TestFind(t *testing.T) {
+	tests := map[string][]string{
+		"div.alert":                    {"Stuff went wrong!", "Heads up"},
+		".alert.alert-info":            {"Heads up"},
+		"#main p":                      {"Paragraph with a nested link."},
+		"div p":                        {"Paragraph with a nested link.", "Footer"},
+		"DIV.footer P":                 {"Footer"},
+		"[role=alert]":                 {"Stuff went wrong!", "Heads up"},
+		`div[role="alert"].alert-info`: {"Heads up"},
+		"p[data-empty]":                {"Paragraph with a nested link."},
+		"p[data-empty='']":             {"Paragraph with a nested link."},
+		"a[href=/y]":                   nil,
+		"#main i, .footer p":           {"nested", "Footer"},
+		"*#login input[type=hidden]":   {""},
+		"span":                         nil,
+		"head":                         {"Test"},
+	}
+	for sel, want := range tests {
+		t.Run(sel, func(t *testing.T) {
+			var ft fakeT
+			doc := htmltest.Parse(&ft, page)
+			got := doc.Texts(sel)
+			if len(ft.errors) > 0 {
+				t.Fatalf("errors = %q; want none", ft.errors)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Texts(%q) = %q; want %q", sel, got, want)
+			}
+		})
+	}
+}
+
+func TestCompile_invalid(t *testing.T) {
+	for _, sel := range []string{"", "  ", "div,", ",div", "div.", "#", "[]", "[=x]", "div[x", "a>b", "body > p", "a + b"} {
+		if _, err := htmltest.Compile(sel); err == nil {
+			t.Errorf("Compile(%q) err = nil; want an error", sel)
+		}
+	}
+}
+
+func TestElement_scoped(t *testing.T) {
+	doc := htmltest.Parse(t, page)
+	main := doc.First("#main")
+	if main == nil {
+		t.Fatalf("First(#main) = nil; want an element")
+	}
+	if got := main.Texts("p"); !reflect.DeepEqual(got, []string{"Paragraph with a nested link."}) {
+		t.Errorf("Texts(p) = %q; want only the paragraph inside #main", got)
+	}
+	if class, _ := main.Attr("class"); class != "container wide" {
+		t.Errorf("Attr(class) = %q; want %q", class, "container wide")
+	}
+	if el := doc.First("span"); el != nil {
+		t.Errorf("First(span) = %v; want nil", el)
+	}
+}
+
+func TestForms(t *testing.T) {
+	doc := htmltest.Parse(t, page)
+	forms := doc.Forms()
+	if len(forms) != 1 {
+		t.Fatalf("len(Forms()) = %d; want 1", len(forms))
+	}
+	f := forms[0]
+	if f.Action != "/login" || f.Method != "POST" {
+		t.Errorf("form = %s %s; want POST /login", f.Method, f.Action)
+	}
+	wantFields := []htmltest.Field{
+		{Tag: "input", Name: "csrf_token", Type: "hidden", Value: "abc"},
+		{Tag: "input", Name: "email", Type: "text", Value: "bob@example.com"},
+		{Tag: "input", Name: "remember", Type: "checkbox", Value: "yes", Checked: true},
+		{Tag: "input", Name: "spam", Type: "checkbox", Value: "yes"},
+		{Tag: "select", Name: "plan", Value: "pro"},
+		{Tag: "textarea", Name: "bio", Value: "Hello world"},
+		{Tag: "input", Name: "go", Type: "submit", Value: "Go"},
+		{Tag: "button", Name: "action", Type: "submit", Value: "login"},
+	}
+	if !reflect.DeepEqual(f.Fields, wantFields) {
+		t.Errorf("Fields = %+v; want %+v", f.Fields, wantFields)
+	}
+	wantValues := url.Values{
+		"csrf_token": {"abc"},
+		"email":      {"bob@example.com"},
+		"remember":   {"yes"},
+		"plan":       {"pro"},
+		"bio":        {"Hello world"},
+	}
+	if got := f.Values(); !reflect.DeepEqual(got, wantValues) {
+		t.Errorf("Values() = %v; want %v", got, wantValues)
+	}
+	if field, ok := f.Field("email"); !ok || field.Value != "bob@example.com" {
+		t.Errorf("Field(email) = %+v, %t; want the email field", field, ok)
+	}
+	if _, ok := f.Field("nope"); ok {
+		t.Errorf("Field(nope) ok = true; want false")
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := map[string]struct {
+		assert func(doc *htmltest.Doc)
+		want   []string
+	}{
+		"HasElement pass": {
+			func(doc *htmltest.Doc) { doc.HasElement("form#login input[name=email]") },
+			nil,
+		},
+		"HasElement fail": {
+			func(doc *htmltest.Doc) { doc.HasElement("form#signup") },
+			[]string{`htmltest: no elements match "form#signup"`},
+		},
+		"CountIs pass": {
+			func(doc *htmltest.Doc) { doc.CountIs("div.alert", 2).CountIs("span", 0) },
+			nil,
+		},
+		"CountIs fail": {
+			func(doc *htmltest.Doc) { doc.CountIs("div.alert", 1) },
+			[]string{`htmltest: 2 elements match "div.alert"; want 1`},
+		},
+		"TextEquals pass": {
+			func(doc *htmltest.Doc) { doc.TextEquals("div.alert", "Stuff went wrong!", "Heads up") },
+			nil,
+		},
+		"TextEquals none": {
+			func(doc *htmltest.Doc) { doc.TextEquals("span") },
+			nil,
+		},
+		"TextEquals fail": {
+			func(doc *htmltest.Doc) { doc.TextEquals("div.alert", "Stuff went wrong!") },
+			[]string{`htmltest: text of "div.alert" = ["Stuff went wrong!" "Heads up"]; want ["Stuff went wrong!"]`},
+		},
+		"invalid selector": {
+			func(doc *htmltest.Doc) { doc.HasElement("div[") },
+			[]string{
+				`htmltest: invalid selector "div[": missing ]`,
+				`htmltest: no elements match "div["`,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var ft fakeT
+			tc.assert(htmltest.Parse(&ft, page))
+			if !reflect.DeepEqual(ft.errors, tc.want) {
+				t.Errorf("errors = %q; want %q", ft.errors, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package htmltest
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector is a compiled CSS selector. The supported subset is type
+// selectors (div), classes (.alert), IDs (#main), attributes ([name] and
+// [name=value], with optional quotes around the value), any combination
+// of those (input.error[type=email]), the universal selector (*),
+// descendant combinators separated by whitespace (form input), and groups
+// separated by commas (input, select).
+type Selector struct {
+	src string
+	// groups holds each comma separated selector as a list of compound
+	// selectors, outermost ancestor first.
+	groups [][]compound
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatch
+}
+
+type attrMatch struct {
+	key      string
+	val      string
+	hasValue bool
+}
+
+// Compile parses a selector.
+func Compile(sel string) (Selector, error) {
+	s := Selector{src: sel}
+	for _, group := range split(sel, ",") {
+		var parts []compound
+		for _, part := range split(group, " \t\n") {
+			c, err := parseCompound(part)
+			if err != nil {
+				return Selector{}, fmt.Errorf("htmltest: invalid selector %q: %w", sel, err)
+			}
+			parts = append(parts, c)
+		}
+		if len(parts) == 0 {
+			return Selector{}, fmt.Errorf("htmltest: invalid selector %q: empty selector", sel)
+		}
+		s.groups = append(s.groups, parts)
+	}
+	if len(s.groups) == 0 {
+		return Selector{}, fmt.Errorf("htmltest: invalid selector %q: empty selector", sel)
+	}
+	return s, nil
+}
+
+// MustCompile is like Compile but panics if the selector is invalid.
+func MustCompile(sel string) Selector {
+	s, err := Compile(sel)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s Selector) String() string {
+	return s.src
+}
+
+// split splits s on any of the separators that are outside of attribute
+// brackets and quotes. Empty parts are dropped, except that a trailing or
+// repeated comma leaves an empty group so it is reported as invalid.
+func split(s, seps string) []string {
+	var (
+		parts   []string
+		sb      strings.Builder
+		bracket bool
+		quote   rune
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			bracket = true
+		case r == ']':
+			bracket = false
+		case !bracket && strings.ContainsRune(seps, r):
+			if sb.Len() > 0 || r == ',' {
+				parts = append(parts, sb.String())
+			}
+			sb.Reset()
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	if sb.Len() > 0 || strings.HasSuffix(strings.TrimSpace(s), ",") {
+		parts = append(parts, sb.String())
+	}
+	return parts
+}
+
+func parseCompound(s string) (compound, error) {
+	var c compound
+	i := 0
+	name := func() string {
+		start := i
+		for i < len(s) && isNameByte(s[i]) {
+			i++
+		}
+		return s[start:i]
+	}
+	if i < len(s) && s[i] == '*' {
+		i++
+	} else {
+		c.tag = strings.ToLower(name())
+	}
+	for i < len(s) {
+		switch s[i] {
+		case '.':
+			i++
+			class := name()
+			if class == "" {
+				return c, fmt.Errorf("empty class")
+			}
+			c.classes = append(c.classes, class)
+		case '#':
+			i++
+			c.id = name()
+			if c.id == "" {
+				return c, fmt.Errorf("empty id")
+			}
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return c, fmt.Errorf("missing ]")
+			}
+			a, err := parseAttr(s[i+1 : i+end])
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+			i += end + 1
+		default:
+			return c, fmt.Errorf("unexpected %q", s[i])
+		}
+	}
+	return c, nil
+}
+
+func isNameByte(b byte) bool {
+	return b == '-' || b == '_' ||
+		'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+func parseAttr(s string) (attrMatch, error) {
+	key, val, hasValue := strings.Cut(s, "=")
+	a := attrMatch{
+		key:      strings.ToLower(strings.TrimSpace(key)),
+		hasValue: hasValue,
+	}
+	if a.key == "" {
+		return a, fmt.Errorf("empty attribute name")
+	}
+	val = strings.TrimSpace(val)
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		val = val[1 : len(val)-1]
+	}
+	a.val = val
+	return a, nil
+}
+
+func (c compound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" {
+		if id, _ := attr(n, "id"); id != c.id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		classAttr, _ := attr(n, "class")
+		have := strings.Fields(classAttr)
+		for _, want := range c.classes {
+			if !contains(have, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		v, ok := attr(n, a.key)
+		if !ok || (a.hasValue && v != a.val) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether n matches any of the groups in s.
+func (s Selector) matches(n *html.Node) bool {
+	for _, parts := range s.groups {
+		if matchesParts(parts, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesParts reports whether n matches the last compound selector and
+// each earlier one matches an ancestor, in order.
+func matchesParts(parts []compound, n *html.Node) bool {
+	last := len(parts) - 1
+	if !parts[last].matches(n) {
+		return false
+	}
+	i := last - 1
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if parts[i].matches(p) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,26 @@
 package http
 
 import (
-	"io"
+	"embed"
+	"io/fs"
 	"net/http"
+
+	"github.com/joncalhoun/twg/view"
 )
 
+//go:embed templates
+var templates embed.FS
+
+var views = newViews()
+
+func newViews() *view.Engine {
+	tplFS, err := fs.Sub(templates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return &view.Engine{FS: tplFS}
+}
+
 func Handler(w http.ResponseWriter, r *http.Request) {
-	io.WriteString(w, "<html><body>Hello World!</body></html>")
+	views.Render(w, r, http.StatusOK, "hello.gohtml", nil)
 }
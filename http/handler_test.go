@@ -0,0 +1,18 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/joncalhoun/twg/htmltest"
+	twghttp "github.com/joncalhoun/twg/http"
+	"github.com/joncalhoun/twg/httpassert"
+)
+
+func TestHandler(t *testing.T) {
+	res := httpassert.Harness{Handler: http.HandlerFunc(twghttp.Handler)}.
+		Get(t, "/").
+		Status(http.StatusOK).
+		Header("Content-Type", "text/html; charset=utf-8")
+	htmltest.Parse(t, res.Body).TextEquals("body", "Hello World!")
+}
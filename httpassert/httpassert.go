@@ -0,0 +1,121 @@
+// Package httpassert helps test HTTP handlers.
+//
+// A Harness serves requests directly with a handler and returns a Response
+// with chainable assertions for the exact status, body, headers, cookies
+// and redirects:
+//
+//	h := httpassert.Harness{Handler: server}
+//	h.Do(t, httptest.NewRequest("GET", "/", nil)).
+//		Status(200).
+//		BodyEquals("<h1>Welcome!</h1>")
+//
+// While serving, the Harness also watches for handlers that misuse the
+// http.ResponseWriter, such as calling WriteHeader twice, changing headers
+// after they were sent, or writing the body more than once. These are
+// reported as test errors so the bugs they usually indicate fail loudly.
+package httpassert
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+)
+
+// T is the subset of testing.TB used by this package.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Harness serves requests for tests.
+type Harness struct {
+	Handler http.Handler
+	// AllowMultipleWrites allows the body to be written with more than one
+	// call to Write. Handlers that render templates or stream their
+	// response need it; by default a second write is treated as an error
+	// because it usually means a handler ran twice.
+	AllowMultipleWrites bool
+}
+
+// Do serves r and returns the response. Any misuse of the ResponseWriter
+// is reported with t.Errorf.
+func (h Harness) Do(t T, r *http.Request) *Response {
+	t.Helper()
+	w := &checkWriter{rec: httptest.NewRecorder()}
+	h.Handler.ServeHTTP(w, r)
+	for _, p := range w.problems(h.AllowMultipleWrites) {
+		t.Errorf("%s %s: %s", r.Method, r.URL.RequestURI(), p)
+	}
+	res := w.rec.Result()
+	return &Response{
+		t:        t,
+		name:     r.Method + " " + r.URL.RequestURI(),
+		Response: res,
+		Body:     w.rec.Body.String(),
+	}
+}
+
+// Get is shorthand for Do with a GET request for target.
+func (h Harness) Get(t T, target string) *Response {
+	t.Helper()
+	return h.Do(t, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// checkWriter records a response like httptest.ResponseRecorder and notes
+// any misuse by the handler.
+type checkWriter struct {
+	rec *httptest.ResponseRecorder
+	// sent is a copy of the headers at the time they were written, or nil
+	// if they haven't been yet.
+	sent   http.Header
+	code   int
+	writes int
+	misuse []string
+}
+
+func (cw *checkWriter) Header() http.Header {
+	return cw.rec.Header()
+}
+
+func (cw *checkWriter) WriteHeader(code int) {
+	switch {
+	case cw.writes > 0:
+		cw.misuse = append(cw.misuse, fmt.Sprintf("WriteHeader(%d) called after the body was written", code))
+	case cw.sent != nil:
+		cw.misuse = append(cw.misuse, fmt.Sprintf("WriteHeader(%d) called after WriteHeader(%d)", code, cw.code))
+	default:
+		cw.sent = cw.rec.Header().Clone()
+		cw.code = code
+	}
+	cw.rec.WriteHeader(code)
+}
+
+func (cw *checkWriter) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		cw.writes++
+	}
+	n, err := cw.rec.Write(b)
+	if cw.sent == nil {
+		// The recorder sets Content-Type on the first write, like a real
+		// server would, so the headers are copied afterwards.
+		cw.sent = cw.rec.Header().Clone()
+		cw.code = http.StatusOK
+	}
+	return n, err
+}
+
+func (cw *checkWriter) Flush() {
+	cw.rec.Flush()
+}
+
+func (cw *checkWriter) problems(allowMultipleWrites bool) []string {
+	problems := cw.misuse
+	if cw.writes > 1 && !allowMultipleWrites {
+		problems = append(problems, fmt.Sprintf("body written in %d calls to Write; want 1", cw.writes))
+	}
+	if cw.sent != nil && !reflect.DeepEqual(cw.sent, cw.rec.Header()) {
+		problems = append(problems, fmt.Sprintf("headers changed after they were written: sent %v, then %v", cw.sent, cw.rec.Header()))
+	}
+	return problems
+}
@@ -0,0 +1,190 @@
+package httpassert_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/twg/httpassert"
+)
+
+// fakeT records errors instead of failing the test.
+type fakeT struct {
+	errors []string
+}
+
+func (ft *fakeT) Helper() {}
+
+func (ft *fakeT) Errorf(format string, args ...interface{}) {
+	ft.errors = append(ft.errors, fmt.Sprintf(format, args...))
+}
+
+func TestHarness_misuse(t *testing.T) {
+	tests := map[string]struct {
+		handler             http.HandlerFunc
+		allowMultipleWrites bool
+		wantErr             string
+	}{
+		"ok": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, "created")
+			},
+		},
+		"no body": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+		"double WriteHeader": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantErr: "WriteHeader(500) called after WriteHeader(200)",
+		},
+		"WriteHeader after body": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "hi")
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: "WriteHeader(404) called after the body was written",
+		},
+		"double body": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "hi")
+				fmt.Fprint(w, "hi")
+			},
+			wantErr: "body written in 2 calls to Write; want 1",
+		},
+		"multiple writes allowed": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "hi")
+				fmt.Fprint(w, "hi")
+			},
+			allowMultipleWrites: true,
+		},
+		"header after body": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "hi")
+				w.Header().Set("X-Late", "1")
+			},
+			wantErr: "headers changed after they were written",
+		},
+		"double redirect": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/a", http.StatusFound)
+				http.Redirect(w, r, "/b", http.StatusFound)
+			},
+			// http.Redirect writes a short body for GET requests.
+			wantErr: "WriteHeader(302) called after the body was written",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var ft fakeT
+			h := httpassert.Harness{
+				Handler:             tc.handler,
+				AllowMultipleWrites: tc.allowMultipleWrites,
+			}
+			h.Get(&ft, "/path")
+			if tc.wantErr == "" {
+				if len(ft.errors) > 0 {
+					t.Errorf("errors = %v; want none", ft.errors)
+				}
+				return
+			}
+			if len(ft.errors) == 0 {
+				t.Fatalf("errors = none; want one containing %q", tc.wantErr)
+			}
+			if got := ft.errors[0]; !strings.HasPrefix(got, "GET /path: ") || !strings.Contains(got, tc.wantErr) {
+				t.Errorf("errors[0] = %q; want it to contain %q", got, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestResponse(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.Header().Add("Vary", "Cookie")
+		w.Header().Add("Vary", "Accept")
+		http.Redirect(w, r, "/next", http.StatusSeeOther)
+	})
+	h := httpassert.Harness{Handler: handler}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	t.Run("passing", func(t *testing.T) {
+		var ft fakeT
+		res := h.Do(&ft, req).
+			Redirect(http.StatusSeeOther, "/next").
+			Header("Vary", "Cookie, Accept").
+			NoHeader("X-Missing").
+			NoCookie("other").
+			BodyEquals("")
+		if c := res.Cookie("session", "abc"); c == nil {
+			t.Errorf("Cookie() = nil; want the session cookie")
+		}
+		if len(ft.errors) > 0 {
+			t.Errorf("errors = %v; want none", ft.errors)
+		}
+	})
+
+	tests := map[string]struct {
+		assert func(res *httpassert.Response)
+		want   string
+	}{
+		"status": {
+			func(res *httpassert.Response) { res.Status(200) },
+			"POST / status = 303; want 200",
+		},
+		"body": {
+			func(res *httpassert.Response) { res.BodyEquals("hi") },
+			`POST / body = ""; want "hi"`,
+		},
+		"body contains": {
+			func(res *httpassert.Response) { res.BodyContains("hi") },
+			`POST / body = ""; want it to contain "hi"`,
+		},
+		"header value": {
+			func(res *httpassert.Response) { res.Header("Vary", "Cookie") },
+			`POST / header Vary = "Cookie, Accept"; want "Cookie"`,
+		},
+		"header missing": {
+			func(res *httpassert.Response) { res.Header("X-Missing", "") },
+			`POST / header X-Missing is missing; want ""`,
+		},
+		"header set": {
+			func(res *httpassert.Response) { res.NoHeader("vary") },
+			`POST / header vary = ["Cookie" "Accept"]; want it to be unset`,
+		},
+		"cookie value": {
+			func(res *httpassert.Response) { res.Cookie("session", "xyz") },
+			`POST / cookie session = "abc"; want "xyz"`,
+		},
+		"cookie missing": {
+			func(res *httpassert.Response) { res.Cookie("other", "xyz") },
+			`POST / cookie other is not set; want "xyz"`,
+		},
+		"cookie set": {
+			func(res *httpassert.Response) { res.NoCookie("session") },
+			`POST / cookie session = "abc"; want it to be unset`,
+		},
+		"redirect location": {
+			func(res *httpassert.Response) { res.Redirect(http.StatusSeeOther, "/other") },
+			`POST / Location = "/next"; want "/other"`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var ft fakeT
+			tc.assert(h.Do(&ft, req))
+			if len(ft.errors) != 1 || ft.errors[0] != tc.want {
+				t.Errorf("errors = %q; want [%q]", ft.errors, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package httpassert
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Response is a response served by a Harness. Its assertion methods
+// report failures with Errorf and return the Response so they can be
+// chained.
+//
+// The embedded http.Response's Header field is shadowed by the Header
+// assertion, so use r.Response.Header to read headers directly.
+type Response struct {
+	*http.Response
+	// Body is the full response body.
+	Body string
+
+	t    T
+	name string
+}
+
+// Status asserts the response has the status code.
+func (r *Response) Status(want int) *Response {
+	r.t.Helper()
+	if r.StatusCode != want {
+		r.t.Errorf("%s status = %d; want %d", r.name, r.StatusCode, want)
+	}
+	return r
+}
+
+// BodyEquals asserts the response body is exactly want.
+func (r *Response) BodyEquals(want string) *Response {
+	r.t.Helper()
+	if r.Body != want {
+		r.t.Errorf("%s body = %q; want %q", r.name, r.Body, want)
+	}
+	return r
+}
+
+// BodyContains asserts the response body contains want.
+func (r *Response) BodyContains(want string) *Response {
+	r.t.Helper()
+	if !strings.Contains(r.Body, want) {
+		r.t.Errorf("%s body = %q; want it to contain %q", r.name, r.Body, want)
+	}
+	return r
+}
+
+// Header asserts the response has the header set to exactly want. If the
+// header has several values they are joined with ", ".
+func (r *Response) Header(key, want string) *Response {
+	r.t.Helper()
+	values, ok := r.Response.Header[http.CanonicalHeaderKey(key)]
+	if !ok {
+		r.t.Errorf("%s header %s is missing; want %q", r.name, key, want)
+		return r
+	}
+	if got := strings.Join(values, ", "); got != want {
+		r.t.Errorf("%s header %s = %q; want %q", r.name, key, got, want)
+	}
+	return r
+}
+
+// NoHeader asserts the response doesn't have the header.
+func (r *Response) NoHeader(key string) *Response {
+	r.t.Helper()
+	if values, ok := r.Response.Header[http.CanonicalHeaderKey(key)]; ok {
+		r.t.Errorf("%s header %s = %q; want it to be unset", r.name, key, values)
+	}
+	return r
+}
+
+// Cookie asserts the response sets the cookie to value, and returns the
+// cookie, or nil if it isn't set.
+func (r *Response) Cookie(name, value string) *http.Cookie {
+	r.t.Helper()
+	c := r.findCookie(name)
+	if c == nil {
+		r.t.Errorf("%s cookie %s is not set; want %q", r.name, name, value)
+		return nil
+	}
+	if c.Value != value {
+		r.t.Errorf("%s cookie %s = %q; want %q", r.name, name, c.Value, value)
+	}
+	return c
+}
+
+// NoCookie asserts the response doesn't set the cookie.
+func (r *Response) NoCookie(name string) *Response {
+	r.t.Helper()
+	if c := r.findCookie(name); c != nil {
+		r.t.Errorf("%s cookie %s = %q; want it to be unset", r.name, name, c.Value)
+	}
+	return r
+}
+
+// Redirect asserts the response redirects to location with the status
+// code.
+func (r *Response) Redirect(code int, location string) *Response {
+	r.t.Helper()
+	r.Status(code)
+	got := r.Response.Header.Get("Location")
+	if got != location {
+		r.t.Errorf("%s Location = %q; want %q", r.name, got, location)
+	}
+	return r
+}
+
+func (r *Response) findCookie(name string) *http.Cookie {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package psql
+
+import (
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Postgres error codes that we translate into our own errors. See
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeNotNullViolation     = "23502"
+	codeForeignKeyViolation  = "23503"
+	codeUniqueViolation      = "23505"
+	codeSerializationFailure = "40001"
+)
+
+// constraintUsersEmail is the name Postgres gives the UNIQUE constraint on
+// the users.email column.
+const constraintUsersEmail = "users_email_key"
+
+// Error is returned when a driver error can be mapped to one of our common
+// errors. It will match that error via errors.Is, while the original
+// *pq.Error is still available via errors.As.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Is reports whether target is the common error this Error represents.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the original driver error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// UniqueViolation reports whether err was caused by a UNIQUE constraint and,
+// if so, returns the name of the constraint. err may wrap the *pq.Error.
+func UniqueViolation(err error) (constraint string, ok bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != codeUniqueViolation {
+		return "", false
+	}
+	return pqErr.Constraint, true
+}
+
+// EmailTaken reports whether err was caused by the UNIQUE constraint on
+// the users.email column, which Postgres names users_email_key.
+func EmailTaken(err error) bool {
+	constraint, ok := UniqueViolation(err)
+	return ok && constraint == constraintUsersEmail
+}
+
+// translate maps Postgres errors to one of our common errors when
+// possible. Anything it doesn't recognize is returned as-is.
+func translate(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	var kind error
+	switch pqErr.Code {
+	case codeUniqueViolation:
+		kind = ErrDuplicate
+		if pqErr.Constraint == constraintUsersEmail {
+			kind = ErrEmailTaken
+		}
+	case codeForeignKeyViolation:
+		kind = ErrInvalidReference
+	case codeNotNullViolation:
+		kind = ErrRequired
+	case codeSerializationFailure:
+		kind = ErrSerialization
+	default:
+		return err
+	}
+	return &Error{
+		Kind: kind,
+		Err:  err,
+	}
+}
@@ -0,0 +1,92 @@
+package psql
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want error
+	}{
+		"email taken": {
+			err:  &pq.Error{Code: codeUniqueViolation, Constraint: constraintUsersEmail},
+			want: ErrEmailTaken,
+		},
+		"other unique violation": {
+			err:  &pq.Error{Code: codeUniqueViolation, Constraint: "users_pkey"},
+			want: ErrDuplicate,
+		},
+		"foreign key violation": {
+			err:  &pq.Error{Code: codeForeignKeyViolation},
+			want: ErrInvalidReference,
+		},
+		"not null violation": {
+			err:  &pq.Error{Code: codeNotNullViolation},
+			want: ErrRequired,
+		},
+		"serialization failure": {
+			err:  &pq.Error{Code: codeSerializationFailure},
+			want: ErrSerialization,
+		},
+		"wrapped pq error": {
+			err:  errors.Wrap(&pq.Error{Code: codeUniqueViolation, Constraint: constraintUsersEmail}, "wrapped"),
+			want: ErrEmailTaken,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := errors.Wrap(translate(tc.err), "psql: context")
+			if !errors.Is(got, tc.want) {
+				t.Errorf("errors.Is(translate(), %v) = false; want true", tc.want)
+			}
+			var pqErr *pq.Error
+			if !errors.As(got, &pqErr) {
+				t.Errorf("errors.As(translate(), *pq.Error) = false; want true")
+			}
+		})
+	}
+}
+
+func TestEmailTaken(t *testing.T) {
+	tests := map[string]struct {
+		err            error
+		want           bool
+		wantConstraint string
+	}{
+		"email taken":       {&pq.Error{Code: codeUniqueViolation, Constraint: constraintUsersEmail}, true, constraintUsersEmail},
+		"wrapped":           {errors.Wrap(&pq.Error{Code: codeUniqueViolation, Constraint: constraintUsersEmail}, "wrapped"), true, constraintUsersEmail},
+		"other constraint":  {&pq.Error{Code: codeUniqueViolation, Constraint: "users_pkey"}, false, "users_pkey"},
+		"other violation":   {&pq.Error{Code: codeNotNullViolation, Constraint: constraintUsersEmail}, false, ""},
+		"not a pq error":    {errors.New("connection refused"), false, ""},
+		"translated errors": {translate(&pq.Error{Code: codeUniqueViolation, Constraint: constraintUsersEmail}), true, constraintUsersEmail},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := EmailTaken(tc.err); got != tc.want {
+				t.Errorf("EmailTaken() = %t; want %t", got, tc.want)
+			}
+			if got, _ := UniqueViolation(tc.err); got != tc.wantConstraint {
+				t.Errorf("UniqueViolation() constraint = %q; want %q", got, tc.wantConstraint)
+			}
+		})
+	}
+}
+
+func TestTranslate_unknown(t *testing.T) {
+	tests := map[string]error{
+		"unknown pq code": &pq.Error{Code: "42P01"},
+		"not a pq error":  errors.New("connection refused"),
+	}
+	for name, err := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := translate(err)
+			if got != err {
+				t.Errorf("translate() = %v; want %v", got, err)
+			}
+		})
+	}
+}
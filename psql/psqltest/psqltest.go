@@ -0,0 +1,189 @@
+// Package psqltest provides helpers for tests that need to talk to a
+// Postgres database.
+//
+// There are two ways to isolate tests from one another. DB (or Open, when
+// used from TestMain) creates a new, uniquely named database with all of
+// the provided migrations applied. Tx starts a transaction that is rolled
+// back when the test completes, so nothing a test writes is ever seen by
+// another test.
+//
+// Tests only run when the EnvDSN environment variable points at a Postgres
+// server. Without it, or when the server can't be reached, DB and Tx skip
+// the test.
+package psqltest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	// Every user of this package is going to need the driver, so we might
+	// as well register it here.
+	_ "github.com/lib/pq"
+)
+
+// EnvDSN is the environment variable used to look up the DSN of the
+// Postgres server to test against.
+const EnvDSN = "PSQL_DSN"
+
+// ErrUnavailable is returned by Open when no Postgres server is configured
+// or the configured server can't be reached.
+var ErrUnavailable = errors.New("psqltest: Postgres is unavailable")
+
+// DSN returns the DSN of the Postgres server that tests should be run
+// against, or an empty string if EnvDSN isn't set. It should not include a
+// database name; helpers in this package will add one when needed.
+func DSN() string {
+	return os.Getenv(EnvDSN)
+}
+
+// Open will create a new, uniquely named database and apply each of the
+// provided migrations to it in order. The returned teardown function
+// closes the connection and drops the database.
+//
+// Open is intended to be used in TestMain when a package wants to share a
+// single database across all of its tests. Use DB inside of a test.
+//
+// If there is no Postgres server to use, the error wraps ErrUnavailable.
+// TestMain can leave its database nil in that case and let Tx skip the
+// tests that need it.
+func Open(migrations ...string) (*sql.DB, func() error, error) {
+	return OpenDSN(DSN(), migrations...)
+}
+
+// OpenDSN is like Open, but uses the Postgres server at dsn rather than
+// the one returned by DSN.
+func OpenDSN(dsn string, migrations ...string) (*sql.DB, func() error, error) {
+	if dsn == "" {
+		return nil, nil, fmt.Errorf("%w: %s is not set", ErrUnavailable, EnvDSN)
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("psqltest: sql.Open() err = %s", err)
+	}
+	err = admin.Ping()
+	if err != nil {
+		admin.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+	name, err := dbName()
+	if err != nil {
+		admin.Close()
+		return nil, nil, err
+	}
+	_, err = admin.Exec(fmt.Sprintf("CREATE DATABASE %s;", name))
+	if err != nil {
+		admin.Close()
+		return nil, nil, fmt.Errorf("psqltest: error creating database %s: %s", name, err)
+	}
+	drop := func() error {
+		defer admin.Close()
+		_, err := admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s;", name))
+		if err != nil {
+			return fmt.Errorf("psqltest: error dropping database %s: %s", name, err)
+		}
+		return nil
+	}
+
+	db, err := sql.Open("postgres", withDBName(dsn, name))
+	if err != nil {
+		drop()
+		return nil, nil, fmt.Errorf("psqltest: sql.Open() err = %s", err)
+	}
+	for i, migration := range migrations {
+		_, err = db.Exec(migration)
+		if err != nil {
+			db.Close()
+			drop()
+			return nil, nil, fmt.Errorf("psqltest: error applying migration %d: %s", i, err)
+		}
+	}
+	return db, func() error {
+		db.Close()
+		return drop()
+	}, nil
+}
+
+// DB is like Open but is intended to be used inside of a single test. The
+// database is dropped via t.Cleanup once the test and all of its subtests
+// have completed. If there is no Postgres server to use, the test is
+// skipped.
+func DB(t *testing.T, migrations ...string) *sql.DB {
+	t.Helper()
+	db, teardown, err := Open(migrations...)
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("psqltest.Open() err = %s", err)
+	}
+	t.Cleanup(func() {
+		if err := teardown(); err != nil {
+			t.Errorf("psqltest teardown err = %s", err)
+		}
+	})
+	return db
+}
+
+// Tx begins a transaction on db that is rolled back via t.Cleanup when the
+// test completes. *sql.Tx has the same Exec and QueryRow methods as
+// *sql.DB, so it can be used by any store that expects those.
+//
+// Because nothing is ever committed, tests using Tx can share a database
+// without cleaning up after themselves. Tests that need to observe writes
+// from other connections, such as race tests, should use DB instead.
+//
+// If db is nil, because Open returned ErrUnavailable, the test is skipped.
+func Tx(t *testing.T, db *sql.DB) *sql.Tx {
+	t.Helper()
+	if db == nil {
+		t.Skip(ErrUnavailable)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("db.Begin() err = %s", err)
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			t.Errorf("tx.Rollback() err = %s", err)
+		}
+	})
+	return tx
+}
+
+// dbName returns a random database name that is safe to use unquoted.
+func dbName() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("psqltest: error generating database name: %s", err)
+	}
+	return "test_" + hex.EncodeToString(b), nil
+}
+
+// withDBName returns dsn updated to connect to the named database. Both
+// URL (postgres://...) and key=value DSNs are supported.
+func withDBName(dsn, name string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			u.Path = "/" + name
+			return u.String()
+		}
+	}
+	var fields []string
+	for _, f := range strings.Fields(dsn) {
+		if strings.HasPrefix(f, "dbname=") {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	fields = append(fields, "dbname="+name)
+	return strings.Join(fields, " ")
+}
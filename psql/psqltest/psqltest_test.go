@@ -0,0 +1,93 @@
+package psqltest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithDBName(t *testing.T) {
+	tests := map[string]struct {
+		dsn  string
+		want string
+	}{
+		"key value": {
+			dsn:  "host=localhost port=5432 user=jon sslmode=disable",
+			want: "host=localhost port=5432 user=jon sslmode=disable dbname=test_abc",
+		},
+		"key value with dbname": {
+			dsn:  "host=localhost dbname=other user=jon",
+			want: "host=localhost user=jon dbname=test_abc",
+		},
+		"url": {
+			dsn:  "postgres://jon@localhost:5432?sslmode=disable",
+			want: "postgres://jon@localhost:5432/test_abc?sslmode=disable",
+		},
+		"url with dbname": {
+			dsn:  "postgresql://jon@localhost/other?sslmode=disable",
+			want: "postgresql://jon@localhost/test_abc?sslmode=disable",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := withDBName(tc.dsn, "test_abc")
+			if got != tc.want {
+				t.Errorf("withDBName() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDBName(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		name, err := dbName()
+		if err != nil {
+			t.Fatalf("dbName() err = %s; want nil", err)
+		}
+		if !strings.HasPrefix(name, "test_") {
+			t.Errorf("dbName() = %q; want prefix %q", name, "test_")
+		}
+		if seen[name] {
+			t.Fatalf("dbName() = %q; want a unique name", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestDSN(t *testing.T) {
+	t.Setenv(EnvDSN, "")
+	if got := DSN(); got != "" {
+		t.Errorf("DSN() = %q; want %q", got, "")
+	}
+	t.Setenv(EnvDSN, "host=db user=test")
+	if got := DSN(); got != "host=db user=test" {
+		t.Errorf("DSN() = %q; want %q", got, "host=db user=test")
+	}
+}
+
+func TestOpenDSN_unavailable(t *testing.T) {
+	tests := map[string]string{
+		"no dsn":      "",
+		"unreachable": "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1",
+	}
+	for name, dsn := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := OpenDSN(dsn)
+			if !errors.Is(err, ErrUnavailable) {
+				t.Errorf("OpenDSN(%q) err = %v; want %v", dsn, err, ErrUnavailable)
+			}
+		})
+	}
+}
+
+func TestDB_skip(t *testing.T) {
+	t.Setenv(EnvDSN, "")
+	var db interface{}
+	t.Run("skipped", func(t *testing.T) {
+		db = DB(t)
+	})
+	if db != nil {
+		t.Errorf("DB() = %v; want the test to be skipped", db)
+	}
+}
@@ -10,7 +10,12 @@ import (
 // Any other errors are wrapped with context vai the github.com/pkg/errors
 // package and returned but are harder to use an if/switch to match.
 var (
-	ErrNotFound = errors.New("psql: resource could not be located")
+	ErrNotFound         = errors.New("psql: resource could not be located")
+	ErrEmailTaken       = errors.New("psql: email address is already taken")
+	ErrDuplicate        = errors.New("psql: resource already exists")
+	ErrInvalidReference = errors.New("psql: referenced resource does not exist")
+	ErrRequired         = errors.New("psql: required value is missing")
+	ErrSerialization    = errors.New("psql: transaction could not be serialized")
 )
 
 // User is an example user model. This typically wouldn't be defined in
@@ -43,18 +48,19 @@ func (us *UserStore) Find(id int) (*User, error) {
 	case nil:
 		return &user, nil
 	default:
-		return nil, errors.Wrap(err, "psql: error querying for user by id")
+		return nil, errors.Wrap(translate(err), "psql: error querying for user by id")
 	}
 }
 
 // Create will create a new user in the DB using the provided user and
-// will update the ID of the provided user. If there is an error it will
-// be wrapped and returned.
+// will update the ID of the provided user. If the email address is
+// already in use the returned error will match ErrEmailTaken when checked
+// with errors.Is. Other errors will be wrapped and returned.
 func (us *UserStore) Create(user *User) error {
 	const query = `INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id`
 	err := us.sql.QueryRow(query, user.Name, user.Email).Scan(&user.ID)
 	if err != nil {
-		return errors.Wrap(err, "psql: error creating new user")
+		return errors.Wrap(translate(err), "psql: error creating new user")
 	}
 	return nil
 }
@@ -65,7 +71,7 @@ func (us *UserStore) Delete(id int) error {
 	const query = `DELETE FROM users WHERE id=$1;`
 	_, err := us.sql.Exec(query, id)
 	if err != nil {
-		return errors.Wrap(err, "psql: error deleting user")
+		return errors.Wrap(translate(err), "psql: error deleting user")
 	}
 	return nil
 }
@@ -7,9 +7,20 @@ import (
 	"reflect"
 	"testing"
 
-	_ "github.com/lib/pq"
+	"github.com/joncalhoun/twg/fixtures"
+	"github.com/joncalhoun/twg/psql/psqltest"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 )
 
+const createUserTable = `CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	name TEXT,
+	email TEXT UNIQUE NOT NULL
+);`
+
+var testDB *sql.DB
+
 func TestMain(m *testing.M) {
 	// 0. flag.Parse() if you need flags
 	exitCode := run(m)
@@ -17,83 +28,81 @@ func TestMain(m *testing.M) {
 }
 
 func run(m *testing.M) int {
-	const (
-		dropDB          = `DROP DATABASE IF EXISTS test_user_store;`
-		createDB        = `CREATE DATABASE test_user_store;`
-		createUserTable = `CREATE TABLE users (
-												 id SERIAL PRIMARY KEY,
-												 name TEXT,
-												 email TEXT UNIQUE NOT NULL
-											 );`
-	)
-
-	psql, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer psql.Close()
-
-	_, err = psql.Exec(dropDB)
-	if err != nil {
-		panic(fmt.Errorf("psql.Exec() err = %s", err))
+	db, teardown, err := psqltest.Open(createUserTable)
+	if errors.Is(err, psqltest.ErrUnavailable) {
+		// testDB stays nil, so psqltest.Tx skips the tests that need it.
+		return m.Run()
 	}
-	_, err = psql.Exec(createDB)
 	if err != nil {
-		panic(fmt.Errorf("psql.Exec() err = %s", err))
+		panic(fmt.Errorf("psqltest.Open() err = %s", err))
 	}
 	// teardown
 	defer func() {
-		_, err = psql.Exec(dropDB)
+		err := teardown()
 		if err != nil {
-			panic(fmt.Errorf("psql.Exec() err = %s", err))
+			panic(err)
 		}
 	}()
-
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer db.Close()
-	_, err = db.Exec(createUserTable)
-	if err != nil {
-		panic(fmt.Errorf("db.Exec() err = %s", err))
-	}
+	testDB = db
 
 	return m.Run()
 }
 
-func TestUserStore(t *testing.T) {
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
+// fixtureStore adapts us so the fixtures package can create users in it.
+func fixtureStore(us *UserStore) fixtures.Store {
+	return fixtures.Store{
+		Create: func(user *fixtures.User) error {
+			u := &User{Name: user.Name, Email: user.Email}
+			err := us.Create(u)
+			user.ID = u.ID
+			return err
+		},
+		Delete: us.Delete,
 	}
-	defer db.Close()
+}
+
+func TestUserStore(t *testing.T) {
 	us := &UserStore{
-		sql: db,
+		sql: psqltest.Tx(t, testDB),
 	}
 	t.Run("Find", testUserStore_Find(us))
 	t.Run("Create", testUserStore_Find(us))
 	t.Run("Delete", testUserStore_Find(us))
 	t.Run("Subscribe", testUserStore_Find(us))
-	// teardown
+}
+
+func TestUserStore_Create_emailTaken(t *testing.T) {
+	us := &UserStore{
+		sql: psqltest.Tx(t, testDB),
+	}
+	err := us.Create(&User{
+		Name:  "Jon Calhoun",
+		Email: "jon@calhoun.io",
+	})
+	if err != nil {
+		t.Fatalf("us.Create() err = %s; want nil", err)
+	}
+	err = us.Create(&User{
+		Name:  "Jon Impostor",
+		Email: "jon@calhoun.io",
+	})
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("us.Create() err = %v; want %v", err, ErrEmailTaken)
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		t.Errorf("us.Create() err = %v; want a wrapped *pq.Error", err)
+	}
 }
 
 func testUserStore_Find(us *UserStore) func(t *testing.T) {
 	return func(t *testing.T) {
+		f := fixtures.NewUser().WithName("Jon Calhoun").Create(t, fixtureStore(us))
 		jon := &User{
-			Name:  "Jon Calhoun",
-			Email: "jon@calhoun.io",
-		}
-		err := us.Create(jon)
-		if err != nil {
-			t.Errorf("us.Create() err = %s", err)
+			ID:    f.ID,
+			Name:  f.Name,
+			Email: f.Email,
 		}
-		defer func() {
-			err := us.Delete(jon.ID)
-			if err != nil {
-				t.Errorf("us.Delete() err = %s", err)
-			}
-		}()
 
 		tests := []struct {
 			name    string
@@ -1,67 +1,18 @@
 package race
 
 import (
-	"database/sql"
-	"fmt"
-	"os"
 	"sync"
 	"testing"
 
-	_ "github.com/lib/pq"
+	"github.com/joncalhoun/twg/psql/psqltest"
 )
 
-func TestMain(m *testing.M) {
-	// 0. flag.Parse() if you need flags
-	exitCode := run(m)
-	os.Exit(exitCode)
-}
-
-func run(m *testing.M) int {
-	const (
-		dropDB          = `DROP DATABASE IF EXISTS test_user_store;`
-		createDB        = `CREATE DATABASE test_user_store;`
-		createUserTable = `CREATE TABLE users (
-												 id SERIAL PRIMARY KEY,
-												 name TEXT,
-												 email TEXT UNIQUE NOT NULL,
-												 balance INTEGER
-											 );`
-	)
-
-	psql, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer psql.Close()
-
-	_, err = psql.Exec(dropDB)
-	if err != nil {
-		panic(fmt.Errorf("psql.Exec() err = %s", err))
-	}
-	_, err = psql.Exec(createDB)
-	if err != nil {
-		panic(fmt.Errorf("psql.Exec() err = %s", err))
-	}
-	// teardown
-	defer func() {
-		_, err = psql.Exec(dropDB)
-		if err != nil {
-			panic(fmt.Errorf("psql.Exec() err = %s", err))
-		}
-	}()
-
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer db.Close()
-	_, err = db.Exec(createUserTable)
-	if err != nil {
-		panic(fmt.Errorf("db.Exec() err = %s", err))
-	}
-
-	return m.Run()
-}
+const createUserTable = `CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	name TEXT,
+	email TEXT UNIQUE NOT NULL,
+	balance INTEGER
+);`
 
 type racyUserStore struct {
 	*UserStore
@@ -79,11 +30,9 @@ func (rus *racyUserStore) Find(id int) (*User, error) {
 }
 
 func TestSpend_race(t *testing.T) {
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer db.Close()
+	// Each spender runs in its own transaction, so this test needs a real
+	// database rather than a rolled back psqltest.Tx.
+	db := psqltest.DB(t, createUserTable)
 	us := &UserStore{
 		sql: db,
 	}
@@ -92,7 +41,7 @@ func TestSpend_race(t *testing.T) {
 		Email:   "jon@calhoun.io",
 		Balance: 100,
 	}
-	err = us.Create(jon)
+	err := us.Create(jon)
 	if err != nil {
 		t.Errorf("us.Create() err = %s", err)
 	}
@@ -0,0 +1,154 @@
+package race
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned by the ledger.
+var (
+	ErrInvalidAmount   = errors.New("race: amount must be positive")
+	ErrInvalidTransfer = errors.New("race: cannot transfer to the same account")
+	ErrUnbalanced      = errors.New("race: ledger entries do not sum to zero")
+	ErrUnreconciled    = errors.New("race: balance does not match the ledger")
+)
+
+// ExternalAccount is the account used for the other side of entries that
+// move money into or out of the system, such as a Deposit or Spend. It
+// never has a User associated with it.
+const ExternalAccount = 0
+
+// Entry is a single, append-only line in the ledger. Every change to a
+// user's balance is recorded as a set of entries that share a TransferID
+// and sum to zero, so money is never created or destroyed; it only moves
+// between accounts.
+type Entry struct {
+	ID         int
+	TransferID int
+	UserID     int
+	Amount     int
+}
+
+// Deposit adds amount to the user's balance from the ExternalAccount.
+func Deposit(tx interface {
+	Tx(sql.IsolationLevel, func(UserStore) error) error
+}, userID int, amount int) error {
+	return tx.Tx(sql.LevelReadCommitted, func(us UserStore) error {
+		return move(us, ExternalAccount, userID, amount)
+	})
+}
+
+// Transfer moves amount from one user's balance to another's inside of a
+// single transaction. ErrInsufficientFunds is returned if the user being
+// transferred from doesn't have enough money.
+func Transfer(tx interface {
+	Tx(sql.IsolationLevel, func(UserStore) error) error
+}, fromID, toID int, amount int) error {
+	return tx.Tx(sql.LevelReadCommitted, func(us UserStore) error {
+		return move(us, fromID, toID, amount)
+	})
+}
+
+// LedgerBalance returns the user's balance as derived from the ledger.
+func LedgerBalance(us UserStore, userID int) (int, error) {
+	entries, err := us.Entries(userID)
+	if err != nil {
+		return 0, err
+	}
+	var balance int
+	for _, e := range entries {
+		balance += e.Amount
+	}
+	return balance, nil
+}
+
+// Reconcile verifies that the user's stored Balance matches the balance
+// derived from the ledger. If it doesn't, the returned error will match
+// ErrUnreconciled when checked with errors.Is.
+//
+// A user's balance only matches the ledger if every change to it was
+// made via Deposit, Transfer or Spend.
+func Reconcile(tx interface {
+	Tx(sql.IsolationLevel, func(UserStore) error) error
+}, userID int) error {
+	return tx.Tx(sql.LevelRepeatableRead, func(us UserStore) error {
+		user, err := us.Find(userID)
+		if err != nil {
+			return err
+		}
+		balance, err := LedgerBalance(us, userID)
+		if err != nil {
+			return err
+		}
+		if user.Balance != balance {
+			return errors.Wrapf(ErrUnreconciled, "race: user %d balance = %d; ledger = %d", userID, user.Balance, balance)
+		}
+		return nil
+	})
+}
+
+// move updates the balances of both accounts and records the entries for
+// it. It must be called inside of a transaction.
+//
+// Users are always locked in order of their ID, regardless of which
+// direction the money is moving. Otherwise two concurrent transfers in
+// opposite directions could each lock one user and then wait forever for
+// the other.
+func move(us UserStore, fromID, toID int, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if fromID == toID {
+		return ErrInvalidTransfer
+	}
+	ids := []int{fromID, toID}
+	if toID < fromID {
+		ids = []int{toID, fromID}
+	}
+	users := make(map[int]*User, 2)
+	for _, id := range ids {
+		if id == ExternalAccount {
+			continue
+		}
+		user, err := us.FindForUpdate(id)
+		if err != nil {
+			return err
+		}
+		users[id] = user
+	}
+	if from, ok := users[fromID]; ok {
+		if from.Balance < amount {
+			return ErrInsufficientFunds
+		}
+		from.Balance -= amount
+	}
+	if to, ok := users[toID]; ok {
+		to.Balance += amount
+	}
+	for _, id := range ids {
+		user, ok := users[id]
+		if !ok {
+			continue
+		}
+		if err := us.Update(user); err != nil {
+			return err
+		}
+	}
+	return post(us,
+		&Entry{UserID: fromID, Amount: -amount},
+		&Entry{UserID: toID, Amount: amount},
+	)
+}
+
+// post records entries in the ledger, verifying that they balance first.
+func post(us UserStore, entries ...*Entry) error {
+	var sum int
+	for _, e := range entries {
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return ErrUnbalanced
+	}
+	return us.CreateEntries(entries...)
+}
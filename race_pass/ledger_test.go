@@ -0,0 +1,178 @@
+package race
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/joncalhoun/twg/fixtures"
+	"github.com/pkg/errors"
+)
+
+func TestLedger_psql(t *testing.T) {
+	testLedger(t, func(t *testing.T) UserStore {
+		return psqlUserStore(t)
+	})
+}
+
+// testLedger runs the ledger tests against any UserStore. newStore should
+// return an empty store every time it is called.
+func testLedger(t *testing.T, newStore func(t *testing.T) UserStore) {
+	t.Run("Transfer", func(t *testing.T) {
+		us := newStore(t)
+		alice := createFunded(t, us, "alice@example.com", 100)
+		bob := createFunded(t, us, "bob@example.com", 0)
+
+		err := Transfer(us, alice.ID, bob.ID, 30)
+		if err != nil {
+			t.Fatalf("Transfer() err = %s; want nil", err)
+		}
+		checkBalance(t, us, alice.ID, 70)
+		checkBalance(t, us, bob.ID, 30)
+
+		entries, err := us.Entries(bob.ID)
+		if err != nil {
+			t.Fatalf("Entries() err = %s; want nil", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("len(Entries()) = %d; want %d", len(entries), 1)
+		}
+		if entries[0].Amount != 30 {
+			t.Errorf("Entries()[0].Amount = %d; want %d", entries[0].Amount, 30)
+		}
+	})
+
+	t.Run("Spend", func(t *testing.T) {
+		us := newStore(t)
+		alice := createFunded(t, us, "alice@example.com", 100)
+
+		err := Spend(us, alice.ID, 40)
+		if err != nil {
+			t.Fatalf("Spend() err = %s; want nil", err)
+		}
+		checkBalance(t, us, alice.ID, 60)
+	})
+
+	t.Run("rejected transfers", func(t *testing.T) {
+		us := newStore(t)
+		alice := createFunded(t, us, "alice@example.com", 100)
+		bob := createFunded(t, us, "bob@example.com", 0)
+
+		tests := map[string]struct {
+			from, to int
+			amount   int
+			want     error
+		}{
+			"insufficient funds": {alice.ID, bob.ID, 101, ErrInsufficientFunds},
+			"zero amount":        {alice.ID, bob.ID, 0, ErrInvalidAmount},
+			"negative amount":    {alice.ID, bob.ID, -10, ErrInvalidAmount},
+			"same account":       {alice.ID, alice.ID, 10, ErrInvalidTransfer},
+			"missing recipient":  {alice.ID, bob.ID + 1000, 10, ErrNotFound},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				err := Transfer(us, tc.from, tc.to, tc.amount)
+				if !errors.Is(err, tc.want) {
+					t.Errorf("Transfer() err = %v; want %v", err, tc.want)
+				}
+				checkBalance(t, us, alice.ID, 100)
+				checkBalance(t, us, bob.ID, 0)
+			})
+		}
+	})
+
+	t.Run("concurrent transfers in both directions", func(t *testing.T) {
+		us := newStore(t)
+		alice := createFunded(t, us, "alice@example.com", 100)
+		bob := createFunded(t, us, "bob@example.com", 100)
+
+		// Transfers in opposite directions would deadlock if users weren't
+		// always locked in the same order.
+		const transfers = 50
+		var wg sync.WaitGroup
+		for i := 0; i < transfers; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if err := Transfer(us, alice.ID, bob.ID, 1); err != nil {
+					t.Errorf("Transfer(alice, bob) err = %s", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if err := Transfer(us, bob.ID, alice.ID, 1); err != nil {
+					t.Errorf("Transfer(bob, alice) err = %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+		checkBalance(t, us, alice.ID, 100)
+		checkBalance(t, us, bob.ID, 100)
+	})
+
+	t.Run("Reconcile detects changes outside the ledger", func(t *testing.T) {
+		us := newStore(t)
+		alice := createFunded(t, us, "alice@example.com", 100)
+
+		user, err := us.Find(alice.ID)
+		if err != nil {
+			t.Fatalf("Find() err = %s; want nil", err)
+		}
+		user.Balance = 1000
+		err = us.Update(user)
+		if err != nil {
+			t.Fatalf("Update() err = %s; want nil", err)
+		}
+		err = Reconcile(us, alice.ID)
+		if !errors.Is(err, ErrUnreconciled) {
+			t.Errorf("Reconcile() err = %v; want %v", err, ErrUnreconciled)
+		}
+	})
+}
+
+// fixtureStore adapts us so the fixtures package can create users in it.
+func fixtureStore(us UserStore) fixtures.Store {
+	return fixtures.Store{
+		Create: func(user *fixtures.User) error {
+			u := &User{Name: user.Name, Email: user.Email, Balance: user.Balance}
+			err := us.Create(u)
+			user.ID = u.ID
+			return err
+		},
+		Delete: us.Delete,
+	}
+}
+
+// createFunded creates a user and deposits balance into their account via
+// the ledger.
+func createFunded(t *testing.T, us UserStore, email string, balance int) *User {
+	t.Helper()
+	f := fixtures.NewUser(fixtures.Broke).WithEmail(email).Create(t, fixtureStore(us))
+	if balance > 0 {
+		err := Deposit(us, f.ID, balance)
+		if err != nil {
+			t.Fatalf("Deposit() err = %s; want nil", err)
+		}
+	}
+	user, err := us.Find(f.ID)
+	if err != nil {
+		t.Fatalf("Find() err = %s; want nil", err)
+	}
+	return user
+}
+
+// checkBalance verifies both the user's stored balance and that it
+// reconciles with the ledger.
+func checkBalance(t *testing.T, us UserStore, userID int, want int) {
+	t.Helper()
+	user, err := us.Find(userID)
+	if err != nil {
+		t.Fatalf("Find() err = %s; want nil", err)
+	}
+	if user.Balance != want {
+		t.Errorf("user.Balance = %d; want %d", user.Balance, want)
+	}
+	err = Reconcile(us, userID)
+	if err != nil {
+		t.Errorf("Reconcile() err = %s; want nil", err)
+	}
+}
@@ -0,0 +1,359 @@
+package race
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemUserStore is an in-memory UserStore. It is safe for concurrent use
+// and its transactions behave much like they do in Postgres, which makes
+// it useful for unit testing code that depends on a UserStore without
+// needing a database.
+//
+// Each transaction works against a snapshot of the store taken when it
+// began, and none of its changes are visible to anyone else until it
+// commits. If a transaction returns an error nothing it did is kept. When
+// two transactions change the same user, whichever commits second fails
+// with ErrConflict and is retried by Tx.
+//
+// FindForUpdate blocks until it can lock the user and then reads the
+// latest committed version of it, just like SELECT ... FOR UPDATE does in
+// Postgres at READ COMMITTED. Unlike Postgres, deadlocks are not detected,
+// so users must always be locked in a consistent order.
+//
+// The isolation level passed to Tx is ignored; every transaction gets
+// snapshot isolation.
+type MemUserStore struct {
+	mu       sync.Mutex
+	users    map[int]User
+	entries  []Entry
+	rowLocks map[int]*sync.Mutex
+
+	nextUserID     int
+	nextEntryID    int
+	nextTransferID int
+}
+
+// NewMemUserStore returns an empty MemUserStore.
+func NewMemUserStore() *MemUserStore {
+	return &MemUserStore{
+		users:          make(map[int]User),
+		rowLocks:       make(map[int]*sync.Mutex),
+		nextUserID:     1,
+		nextEntryID:    1,
+		nextTransferID: 1,
+	}
+}
+
+// Tx runs fn inside of a transaction. See PsqlUserStore.Tx for details on
+// how transactions are committed, rolled back, and retried.
+func (ms *MemUserStore) Tx(level sql.IsolationLevel, fn func(us UserStore) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = ms.tryTx(fn)
+		if !retryable(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	return err
+}
+
+func (ms *MemUserStore) tryTx(fn func(us UserStore) error) error {
+	tx := ms.begin()
+	defer tx.unlock()
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Find will retrieve a user with the provided ID or return ErrNotFound
+// if the user isn't located.
+func (ms *MemUserStore) Find(id int) (*User, error) {
+	var user *User
+	err := ms.tryTx(func(us UserStore) error {
+		var err error
+		user, err = us.Find(id)
+		return err
+	})
+	return user, err
+}
+
+// FindForUpdate is like Find, but it locks the user until the current
+// transaction completes. Outside of Tx the lock is released immediately.
+func (ms *MemUserStore) FindForUpdate(id int) (*User, error) {
+	var user *User
+	err := ms.tryTx(func(us UserStore) error {
+		var err error
+		user, err = us.FindForUpdate(id)
+		return err
+	})
+	return user, err
+}
+
+// Create will add the user to the store, updating its ID and Version.
+func (ms *MemUserStore) Create(user *User) error {
+	return ms.tryTx(func(us UserStore) error {
+		return us.Create(user)
+	})
+}
+
+// Update will update the user if its Version matches the one in the
+// store. Otherwise ErrConflict is returned.
+func (ms *MemUserStore) Update(user *User) error {
+	return ms.tryTx(func(us UserStore) error {
+		return us.Update(user)
+	})
+}
+
+// Delete will remove the user from the store.
+func (ms *MemUserStore) Delete(id int) error {
+	return ms.tryTx(func(us UserStore) error {
+		return us.Delete(id)
+	})
+}
+
+// CreateEntries appends entries to the ledger as part of a single
+// transfer, updating the ID and TransferID of each entry.
+func (ms *MemUserStore) CreateEntries(entries ...*Entry) error {
+	return ms.tryTx(func(us UserStore) error {
+		return us.CreateEntries(entries...)
+	})
+}
+
+// Entries returns all of the ledger entries for a user in the order they
+// were created.
+func (ms *MemUserStore) Entries(userID int) ([]Entry, error) {
+	var entries []Entry
+	err := ms.tryTx(func(us UserStore) error {
+		var err error
+		entries, err = us.Entries(userID)
+		return err
+	})
+	return entries, err
+}
+
+// begin starts a new transaction using a snapshot of the committed state.
+func (ms *MemUserStore) begin() *memTx {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	tx := &memTx{
+		store:   ms,
+		users:   make(map[int]User, len(ms.users)),
+		base:    make(map[int]int, len(ms.users)),
+		written: make(map[int]bool),
+		created: make(map[int]bool),
+		deleted: make(map[int]bool),
+		entries: make([]Entry, len(ms.entries)),
+		locked:  make(map[int]*sync.Mutex),
+	}
+	for id, user := range ms.users {
+		tx.users[id] = user
+		tx.base[id] = user.Version
+	}
+	copy(tx.entries, ms.entries)
+	return tx
+}
+
+func (ms *MemUserStore) rowLock(id int) *sync.Mutex {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	l, ok := ms.rowLocks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		ms.rowLocks[id] = l
+	}
+	return l
+}
+
+// memTx is a single transaction against a MemUserStore. It is not safe for
+// concurrent use, just like a *sql.Tx.
+type memTx struct {
+	store *MemUserStore
+
+	// users is this transaction's view of the store, including its own
+	// uncommitted changes.
+	users map[int]User
+	// base is the committed version of each user as of when this
+	// transaction last read it. Commit fails with ErrConflict if any user
+	// this transaction changed has been committed by someone else since.
+	base    map[int]int
+	written map[int]bool
+	created map[int]bool
+	deleted map[int]bool
+
+	entries    []Entry
+	newEntries []Entry
+
+	locked map[int]*sync.Mutex
+}
+
+func (tx *memTx) Tx(level sql.IsolationLevel, fn func(us UserStore) error) error {
+	return fn(tx)
+}
+
+func (tx *memTx) Find(id int) (*User, error) {
+	user, ok := tx.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (tx *memTx) FindForUpdate(id int) (*User, error) {
+	if _, ok := tx.locked[id]; !ok {
+		l := tx.store.rowLock(id)
+		l.Lock()
+		tx.locked[id] = l
+	}
+	if !tx.written[id] && !tx.deleted[id] {
+		// Just like Postgres at READ COMMITTED, once we have the lock we
+		// want the latest committed version of the user rather than the
+		// one from our snapshot.
+		tx.store.mu.Lock()
+		user, ok := tx.store.users[id]
+		tx.store.mu.Unlock()
+		if ok {
+			tx.users[id] = user
+			tx.base[id] = user.Version
+		} else {
+			delete(tx.users, id)
+		}
+	}
+	return tx.Find(id)
+}
+
+func (tx *memTx) Create(user *User) error {
+	if tx.emailTaken(user.ID, user.Email) {
+		return ErrEmailTaken
+	}
+	tx.store.mu.Lock()
+	user.ID = tx.store.nextUserID
+	tx.store.nextUserID++
+	tx.store.mu.Unlock()
+	user.Version = 1
+	tx.users[user.ID] = *user
+	tx.written[user.ID] = true
+	tx.created[user.ID] = true
+	return nil
+}
+
+func (tx *memTx) Update(user *User) error {
+	existing, ok := tx.users[user.ID]
+	if !ok || existing.Version != user.Version {
+		return ErrConflict
+	}
+	if tx.emailTaken(user.ID, user.Email) {
+		return ErrEmailTaken
+	}
+	updated := *user
+	updated.Version++
+	tx.users[user.ID] = updated
+	tx.written[user.ID] = true
+	user.Version++
+	return nil
+}
+
+func (tx *memTx) Delete(id int) error {
+	if _, ok := tx.users[id]; !ok {
+		return nil
+	}
+	delete(tx.users, id)
+	delete(tx.written, id)
+	if tx.created[id] {
+		delete(tx.created, id)
+		return nil
+	}
+	tx.deleted[id] = true
+	return nil
+}
+
+func (tx *memTx) CreateEntries(entries ...*Entry) error {
+	tx.store.mu.Lock()
+	transferID := tx.store.nextTransferID
+	tx.store.nextTransferID++
+	for _, e := range entries {
+		e.ID = tx.store.nextEntryID
+		e.TransferID = transferID
+		tx.store.nextEntryID++
+	}
+	tx.store.mu.Unlock()
+	for _, e := range entries {
+		tx.newEntries = append(tx.newEntries, *e)
+	}
+	return nil
+}
+
+func (tx *memTx) Entries(userID int) ([]Entry, error) {
+	var ret []Entry
+	for _, entries := range [][]Entry{tx.entries, tx.newEntries} {
+		for _, e := range entries {
+			if e.UserID == userID {
+				ret = append(ret, e)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+// emailTaken reports whether any user other than id is using email in
+// this transaction's view of the store.
+func (tx *memTx) emailTaken(id int, email string) bool {
+	for _, user := range tx.users {
+		if user.ID != id && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// commit applies the transaction's changes to the store, or returns an
+// error without applying any of them if they conflict with changes
+// committed since this transaction read them.
+func (tx *memTx) commit() error {
+	ms := tx.store
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, changed := range []map[int]bool{tx.written, tx.deleted} {
+		for id := range changed {
+			if tx.created[id] {
+				continue
+			}
+			user, ok := ms.users[id]
+			if !ok || user.Version != tx.base[id] {
+				return ErrConflict
+			}
+		}
+	}
+	for id := range tx.written {
+		email := tx.users[id].Email
+		for _, user := range ms.users {
+			if user.ID != id && user.Email == email && !tx.deleted[user.ID] && !tx.written[user.ID] {
+				return ErrEmailTaken
+			}
+		}
+	}
+	for id := range tx.written {
+		ms.users[id] = tx.users[id]
+	}
+	for id := range tx.deleted {
+		delete(ms.users, id)
+	}
+	ms.entries = append(ms.entries, tx.newEntries...)
+	return nil
+}
+
+// unlock releases any locks acquired by FindForUpdate.
+func (tx *memTx) unlock() {
+	for id, l := range tx.locked {
+		l.Unlock()
+		delete(tx.locked, id)
+	}
+}
@@ -0,0 +1,17 @@
+package race
+
+import "testing"
+
+var _ UserStore = &MemUserStore{}
+
+func TestMemUserStore(t *testing.T) {
+	testUserStore(t, func(t *testing.T) UserStore {
+		return NewMemUserStore()
+	})
+}
+
+func TestLedger_mem(t *testing.T) {
+	testLedger(t, func(t *testing.T) UserStore {
+		return NewMemUserStore()
+	})
+}
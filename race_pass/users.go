@@ -1,8 +1,12 @@
 package race
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
+	pgerr "github.com/joncalhoun/twg/psql"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -10,9 +14,16 @@ import (
 // Any other errors are wrapped with context vai the github.com/pkg/errors
 // package and returned but are harder to use an if/switch to match.
 var (
-	ErrNotFound = errors.New("race: resource could not be located")
+	ErrNotFound          = errors.New("race: resource could not be located")
+	ErrConflict          = errors.New("race: resource was modified by another transaction")
+	ErrEmailTaken        = errors.New("race: email address is already taken")
+	ErrInsufficientFunds = errors.New("race: insufficient funds")
 )
 
+// maxTxAttempts is the number of times Tx will run a transaction that
+// fails with a retryable error before giving up.
+const maxTxAttempts = 10
+
 // User is an example user model. This typically wouldn't be defined in
 // this package but is done here for simplicity.
 type User struct {
@@ -20,31 +31,66 @@ type User struct {
 	Name    string
 	Email   string
 	Balance int
+	// Version is incremented every time the user is updated and is used to
+	// detect concurrent modifications.
+	Version int
 }
 
 type UserStore interface {
-	Tx(func(UserStore) error) error
+	Tx(level sql.IsolationLevel, fn func(UserStore) error) error
 	Find(id int) (*User, error)
+	FindForUpdate(id int) (*User, error)
 	Create(user *User) error
 	Update(user *User) error
 	Delete(id int) error
+
+	CreateEntries(entries ...*Entry) error
+	Entries(userID int) ([]Entry, error)
 }
 
 // PsqlUserStore is used to interact with our user store.
 type PsqlUserStore struct {
 	tx interface {
-		Begin() (*sql.Tx, error)
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 	}
 	sql interface {
 		Exec(query string, args ...interface{}) (sql.Result, error)
+		Query(query string, args ...interface{}) (*sql.Rows, error)
 		QueryRow(query string, args ...interface{}) *sql.Row
 	}
 }
 
-func (pus *PsqlUserStore) Tx(fn func(us UserStore) error) error {
-	tx, err := pus.tx.Begin()
+// Tx runs fn inside of a transaction using the provided isolation level.
+// If fn returns nil the transaction is committed, otherwise it is rolled
+// back and the error is returned.
+//
+// Transactions that fail because of a concurrent modification, either
+// ErrConflict or a Postgres serialization failure or deadlock, are retried
+// with a fresh transaction up to maxTxAttempts times, so fn should not
+// have side effects outside of the UserStore it is given.
+//
+// Calling Tx on a UserStore that is already in a transaction runs fn in
+// that transaction.
+func (pus *PsqlUserStore) Tx(level sql.IsolationLevel, fn func(us UserStore) error) error {
+	if pus.tx == nil {
+		return fn(pus)
+	}
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = pus.tryTx(level, fn)
+		if !retryable(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	return err
+}
+
+func (pus *PsqlUserStore) tryTx(level sql.IsolationLevel, fn func(us UserStore) error) error {
+	tx, err := pus.tx.BeginTx(context.Background(), &sql.TxOptions{
+		Isolation: level,
+	})
 	if err != nil {
-		tx.Rollback()
 		return errors.Wrap(err, "race: failed to begin transaction")
 	}
 	txStore := &PsqlUserStore{
@@ -62,14 +108,47 @@ func (pus *PsqlUserStore) Tx(fn func(us UserStore) error) error {
 	return nil
 }
 
+// retryable reports whether err was caused by a concurrent transaction and
+// is likely to succeed if the transaction is attempted again.
+func retryable(err error) bool {
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code {
+	case "40001", // serialization_failure
+		"40P01": // deadlock_detected
+		return true
+	}
+	return false
+}
+
 // Find will retrieve a user with the provided ID or return ErrNotFount
 // if the user isn't located. Other errors are wrapped with context
 // but are otherwise wrapped as-is.
 func (pus *PsqlUserStore) Find(id int) (*User, error) {
-	const query = `SELECT id, name, email, balance FROM users WHERE id=$1;`
+	const query = `SELECT id, name, email, balance, version FROM users WHERE id=$1;`
+	return pus.find(query, id)
+}
+
+// FindForUpdate is like Find, but it also locks the user's row until the
+// current transaction completes. Any other transaction calling
+// FindForUpdate or Update for the same user will block until then.
+//
+// FindForUpdate is only useful inside of Tx. Outside of a transaction the
+// lock is released as soon as the query completes.
+func (pus *PsqlUserStore) FindForUpdate(id int) (*User, error) {
+	const query = `SELECT id, name, email, balance, version FROM users WHERE id=$1 FOR UPDATE;`
+	return pus.find(query, id)
+}
+
+func (pus *PsqlUserStore) find(query string, id int) (*User, error) {
 	row := pus.sql.QueryRow(query, id)
 	var user User
-	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Balance)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Balance, &user.Version)
 	switch err {
 	case sql.ErrNoRows:
 		return nil, ErrNotFound
@@ -81,24 +160,42 @@ func (pus *PsqlUserStore) Find(id int) (*User, error) {
 }
 
 // Create will create a new user in the DB using the provided user and
-// will update the ID of the provided user. If there is an error it will
-// be wrapped and returned.
+// will update the ID and Version of the provided user. ErrEmailTaken is
+// returned if the email address is in use. Other errors will be wrapped
+// and returned.
 func (pus *PsqlUserStore) Create(user *User) error {
-	const query = `INSERT INTO users (name, email, balance) VALUES ($1, $2, $3) RETURNING id`
-	err := pus.sql.QueryRow(query, user.Name, user.Email, user.Balance).Scan(&user.ID)
+	const query = `INSERT INTO users (name, email, balance) VALUES ($1, $2, $3) RETURNING id, version`
+	err := pus.sql.QueryRow(query, user.Name, user.Email, user.Balance).Scan(&user.ID, &user.Version)
+	if pgerr.EmailTaken(err) {
+		return ErrEmailTaken
+	}
 	if err != nil {
 		return errors.Wrap(err, "race: error creating new user")
 	}
 	return nil
 }
 
-// Update will update a user in the DB with the provided info.
+// Update will update a user in the DB with the provided info. The update
+// only succeeds if the user's Version matches the one in the DB, in which
+// case the Version is incremented. Otherwise the user was modified (or
+// deleted) since it was read and ErrConflict is returned.
 func (pus *PsqlUserStore) Update(user *User) error {
-	const query = `UPDATE users SET name=$2, email=$3, balance=$4 WHERE id=$1`
-	_, err := pus.sql.Exec(query, user.ID, user.Name, user.Email, user.Balance)
+	const query = `UPDATE users SET name=$2, email=$3, balance=$4, version=version+1 WHERE id=$1 AND version=$5`
+	res, err := pus.sql.Exec(query, user.ID, user.Name, user.Email, user.Balance, user.Version)
+	if pgerr.EmailTaken(err) {
+		return ErrEmailTaken
+	}
 	if err != nil {
 		return errors.Wrap(err, "race: error updating user")
 	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "race: error updating user")
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	user.Version++
 	return nil
 }
 
@@ -113,15 +210,65 @@ func (pus *PsqlUserStore) Delete(id int) error {
 	return nil
 }
 
-func Spend(tx interface {
-	Tx(func(UserStore) error) error
-}, userID int, amount int) error {
-	return tx.Tx(func(us UserStore) error {
-		user, err := us.Find(userID)
+// CreateEntries appends entries to the ledger as part of a single
+// transfer, updating the ID and TransferID of each entry. Entries are
+// never updated or deleted once created.
+//
+// CreateEntries should be called inside of Tx so that either all of the
+// entries are created or none are.
+func (pus *PsqlUserStore) CreateEntries(entries ...*Entry) error {
+	const (
+		transferQuery = `INSERT INTO transfers DEFAULT VALUES RETURNING id`
+		entryQuery    = `INSERT INTO entries (transfer_id, user_id, amount) VALUES ($1, $2, $3) RETURNING id`
+	)
+	var transferID int
+	err := pus.sql.QueryRow(transferQuery).Scan(&transferID)
+	if err != nil {
+		return errors.Wrap(err, "race: error creating transfer")
+	}
+	for _, e := range entries {
+		e.TransferID = transferID
+		err := pus.sql.QueryRow(entryQuery, e.TransferID, e.UserID, e.Amount).Scan(&e.ID)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "race: error creating ledger entry")
+		}
+	}
+	return nil
+}
+
+// Entries returns all of the ledger entries for a user in the order they
+// were created.
+func (pus *PsqlUserStore) Entries(userID int) ([]Entry, error) {
+	const query = `SELECT id, transfer_id, user_id, amount FROM entries WHERE user_id=$1 ORDER BY id;`
+	rows, err := pus.sql.Query(query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "race: error querying for ledger entries")
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		err := rows.Scan(&e.ID, &e.TransferID, &e.UserID, &e.Amount)
+		if err != nil {
+			return nil, errors.Wrap(err, "race: error scanning ledger entry")
 		}
-		user.Balance -= amount
-		return us.Update(user)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "race: error querying for ledger entries")
+	}
+	return entries, nil
+}
+
+// Spend removes amount from the user's balance and records it in the
+// ledger as a transfer to the ExternalAccount. The user's row is locked
+// for the duration of the transaction so concurrent calls to Spend can't
+// lose updates. ErrInsufficientFunds is returned if the user's balance is
+// less than amount.
+func Spend(tx interface {
+	Tx(sql.IsolationLevel, func(UserStore) error) error
+}, userID int, amount int) error {
+	return tx.Tx(sql.LevelReadCommitted, func(us UserStore) error {
+		return move(us, userID, ExternalAccount, amount)
 	})
 }
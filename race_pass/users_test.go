@@ -2,100 +2,92 @@ package race
 
 import (
 	"database/sql"
-	"fmt"
-	"os"
+	"errors"
+	"reflect"
 	"sync"
 	"testing"
 
-	_ "github.com/lib/pq"
+	"github.com/joncalhoun/twg/psql/psqltest"
 )
 
 var a = "a"
 
-func TestMain(m *testing.M) {
-	// 0. flag.Parse() if you need flags
-	exitCode := run(m)
-	os.Exit(exitCode)
+var migrations = []string{
+	`CREATE TABLE users (
+		id SERIAL PRIMARY KEY,
+		name TEXT,
+		email TEXT UNIQUE NOT NULL,
+		balance INTEGER,
+		version INTEGER NOT NULL DEFAULT 1
+	);`,
+	`CREATE TABLE transfers (
+		id SERIAL PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL DEFAULT now()
+	);`,
+	`CREATE TABLE entries (
+		id SERIAL PRIMARY KEY,
+		transfer_id INTEGER NOT NULL REFERENCES transfers(id),
+		user_id INTEGER NOT NULL,
+		amount INTEGER NOT NULL
+	);`,
 }
 
-func run(m *testing.M) int {
-	const (
-		dropDB          = `DROP DATABASE IF EXISTS test_user_store;`
-		createDB        = `CREATE DATABASE test_user_store;`
-		createUserTable = `CREATE TABLE users (
-												 id SERIAL PRIMARY KEY,
-												 name TEXT,
-												 email TEXT UNIQUE NOT NULL,
-												 balance INTEGER
-											 );`
-	)
-
-	psql, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer psql.Close()
+// maxOpenConns caps the connections each test database uses. Concurrent
+// tests start more transactions than a stock Postgres server allows
+// clients, so the extra ones wait for a free connection.
+const maxOpenConns = 10
 
-	_, err = psql.Exec(dropDB)
-	if err != nil {
-		panic(fmt.Errorf("psql.Exec() err = %s", err))
-	}
-	_, err = psql.Exec(createDB)
-	if err != nil {
-		panic(fmt.Errorf("psql.Exec() err = %s", err))
+// psqlUserStore returns a PsqlUserStore backed by a fresh database that
+// is dropped once the test completes.
+func psqlUserStore(t *testing.T) *PsqlUserStore {
+	t.Helper()
+	db := psqltest.DB(t, migrations...)
+	db.SetMaxOpenConns(maxOpenConns)
+	return &PsqlUserStore{
+		tx:  db,
+		sql: db,
 	}
-	// teardown
-	defer func() {
-		_, err = psql.Exec(dropDB)
-		if err != nil {
-			panic(fmt.Errorf("psql.Exec() err = %s", err))
-		}
-	}()
+}
 
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer db.Close()
-	_, err = db.Exec(createUserTable)
-	if err != nil {
-		panic(fmt.Errorf("db.Exec() err = %s", err))
-	}
+// racyUserStore holds every transaction it starts at a barrier just before
+// its first FindForUpdate, until all of the other spenders' transactions
+// have reached that point too. Each spender needs its own racyUserStore.
+type racyUserStore struct {
+	UserStore
+	barrier *sync.WaitGroup
+	once    sync.Once
+}
 
-	return m.Run()
+func (rus *racyUserStore) Tx(level sql.IsolationLevel, fn func(UserStore) error) error {
+	return rus.UserStore.Tx(level, func(us UserStore) error {
+		return fn(&racyTx{UserStore: us, rus: rus})
+	})
 }
 
-type racyUserStore struct {
+type racyTx struct {
 	UserStore
-	wg *sync.WaitGroup
+	rus *racyUserStore
 }
 
-func (rus *racyUserStore) Find(id int) (*User, error) {
-	user, err := rus.UserStore.Find(id)
-	if err != nil {
-		return nil, err
-	}
-	rus.wg.Done()
-	rus.wg.Wait()
-	return user, err
+func (rtx *racyTx) FindForUpdate(id int) (*User, error) {
+	// Retried transactions have already been through the barrier.
+	rtx.rus.once.Do(func() {
+		rtx.rus.barrier.Done()
+		rtx.rus.barrier.Wait()
+	})
+	return rtx.UserStore.FindForUpdate(id)
 }
 
 func TestSpend_race(t *testing.T) {
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=jon sslmode=disable dbname=test_user_store")
-	if err != nil {
-		panic(fmt.Errorf("sql.Open() err = %s", err))
-	}
-	defer db.Close()
-	us := &PsqlUserStore{
-		tx:  db,
-		sql: db,
-	}
+	// Each spender runs in its own transaction, so this test needs a real
+	// database rather than a rolled back psqltest.Tx.
+	us := psqlUserStore(t)
 	jon := &User{
 		Name:    "Jon Calhoun",
 		Email:   "jon@calhoun.io",
 		Balance: 100,
 	}
-	err = us.Create(jon)
+	err := us.Create(jon)
 	if err != nil {
 		t.Errorf("us.Create() err = %s", err)
 	}
@@ -106,20 +98,20 @@ func TestSpend_race(t *testing.T) {
 		}
 	}()
 
-	rus := &racyUserStore{
-		UserStore: us,
-		wg:        &sync.WaitGroup{},
-	}
-	rus.wg.Add(2)
+	// Both spenders read the balance at the same time, so without the row
+	// lock each would subtract from 100 and one spend would be lost.
+	var barrier sync.WaitGroup
+	barrier.Add(2)
 	var spendWg sync.WaitGroup
 	for i := 0; i < 2; i++ {
 		spendWg.Add(1)
 		go func() {
+			defer spendWg.Done()
+			rus := &racyUserStore{UserStore: us, barrier: &barrier}
 			err := Spend(rus, jon.ID, 25)
 			if err != nil {
-				t.Fatalf("Spend() err = %s", err)
+				t.Errorf("Spend() err = %s", err)
 			}
-			spendWg.Done()
 		}()
 	}
 	spendWg.Wait()
@@ -131,3 +123,274 @@ func TestSpend_race(t *testing.T) {
 		t.Fatalf("user.Balance = %d; want %d", got.Balance, 50)
 	}
 }
+
+func TestPsqlUserStore(t *testing.T) {
+	testUserStore(t, func(t *testing.T) UserStore {
+		return psqlUserStore(t)
+	})
+}
+
+// testUserStore runs the behavioral tests every UserStore implementation
+// should pass. newStore should return an empty store every time it is
+// called.
+func testUserStore(t *testing.T, newStore func(t *testing.T) UserStore) {
+	t.Run("Create Find Delete", func(t *testing.T) {
+		us := newStore(t)
+		jon := &User{
+			Name:    "Jon Calhoun",
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		err := us.Create(jon)
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+		if jon.ID <= 0 {
+			t.Errorf("user.ID = %d; want a positive value", jon.ID)
+		}
+		got, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		if !reflect.DeepEqual(got, jon) {
+			t.Errorf("us.Find() = %+v; want %+v", got, jon)
+		}
+		err = us.Delete(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Delete() err = %s", err)
+		}
+		_, err = us.Find(jon.ID)
+		if err != ErrNotFound {
+			t.Errorf("us.Find() err = %v; want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("Create email taken", func(t *testing.T) {
+		us := newStore(t)
+		err := us.Create(&User{Email: "jon@calhoun.io"})
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+		err = us.Create(&User{Email: "jon@calhoun.io"})
+		if err != ErrEmailTaken {
+			t.Errorf("us.Create() err = %v; want %v", err, ErrEmailTaken)
+		}
+	})
+
+	t.Run("Tx rolls back on error", func(t *testing.T) {
+		us := newStore(t)
+		jon := &User{
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		err := us.Create(jon)
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+		var created *User
+		wantErr := errors.New("oops")
+		err = us.Tx(sql.LevelReadCommitted, func(us UserStore) error {
+			user, err := us.Find(jon.ID)
+			if err != nil {
+				return err
+			}
+			user.Balance = 0
+			if err := us.Update(user); err != nil {
+				return err
+			}
+			created = &User{Email: "bob@example.com"}
+			if err := us.Create(created); err != nil {
+				return err
+			}
+			return wantErr
+		})
+		if err != wantErr {
+			t.Fatalf("us.Tx() err = %v; want %v", err, wantErr)
+		}
+		got, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		if got.Balance != 100 {
+			t.Errorf("user.Balance = %d; want %d", got.Balance, 100)
+		}
+		_, err = us.Find(created.ID)
+		if err != ErrNotFound {
+			t.Errorf("us.Find() err = %v; want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("Tx repeatable read", func(t *testing.T) {
+		us := newStore(t)
+		jon := &User{
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		err := us.Create(jon)
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+		err = us.Tx(sql.LevelRepeatableRead, func(tx UserStore) error {
+			before, err := tx.Find(jon.ID)
+			if err != nil {
+				return err
+			}
+			// Update the user outside of the transaction. It shouldn't be
+			// visible inside of it.
+			outside, err := us.Find(jon.ID)
+			if err != nil {
+				return err
+			}
+			outside.Balance = 50
+			if err := us.Update(outside); err != nil {
+				return err
+			}
+			after, err := tx.Find(jon.ID)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(after, before) {
+				t.Errorf("tx.Find() = %+v; want %+v", after, before)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("us.Tx() err = %s", err)
+		}
+	})
+
+	t.Run("Update conflict", func(t *testing.T) {
+		us := newStore(t)
+		jon := &User{
+			Name:    "Jon Calhoun",
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		err := us.Create(jon)
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+		a, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		b, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		a.Balance = 75
+		err = us.Update(a)
+		if err != nil {
+			t.Fatalf("us.Update() err = %s; want nil", err)
+		}
+		if a.Version != jon.Version+1 {
+			t.Errorf("user.Version = %d; want %d", a.Version, jon.Version+1)
+		}
+		b.Balance = 50
+		err = us.Update(b)
+		if err != ErrConflict {
+			t.Fatalf("us.Update() err = %v; want %v", err, ErrConflict)
+		}
+		got, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		if got.Balance != 75 {
+			t.Errorf("user.Balance = %d; want %d", got.Balance, 75)
+		}
+	})
+
+	t.Run("Tx retries conflicts", func(t *testing.T) {
+		us := newStore(t)
+		jon := &User{
+			Name:    "Jon Calhoun",
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		err := us.Create(jon)
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+
+		// Without a row lock concurrent updates conflict with one another,
+		// so this only works because Tx retries on ErrConflict.
+		const spenders = 5
+		var wg sync.WaitGroup
+		for i := 0; i < spenders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := us.Tx(sql.LevelReadCommitted, func(us UserStore) error {
+					user, err := us.Find(jon.ID)
+					if err != nil {
+						return err
+					}
+					user.Balance -= 10
+					return us.Update(user)
+				})
+				if err != nil {
+					t.Errorf("us.Tx() err = %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+		got, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		if got.Balance != 100-spenders*10 {
+			t.Errorf("user.Balance = %d; want %d", got.Balance, 100-spenders*10)
+		}
+	})
+
+	t.Run("Spend concurrent", func(t *testing.T) {
+		us := newStore(t)
+		jon := &User{
+			Name:    "Jon Calhoun",
+			Email:   "jon@calhoun.io",
+			Balance: 100,
+		}
+		err := us.Create(jon)
+		if err != nil {
+			t.Fatalf("us.Create() err = %s", err)
+		}
+
+		// More spenders than the balance can cover, so some of them must be
+		// rejected rather than overdrawing the account.
+		const spenders = 150
+		var mu sync.Mutex
+		var spent, rejected int
+		var wg sync.WaitGroup
+		for i := 0; i < spenders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := Spend(us, jon.ID, 1)
+				mu.Lock()
+				defer mu.Unlock()
+				switch err {
+				case nil:
+					spent++
+				case ErrInsufficientFunds:
+					rejected++
+				default:
+					t.Errorf("Spend() err = %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if spent != 100 {
+			t.Errorf("successful spends = %d; want %d", spent, 100)
+		}
+		if rejected != spenders-100 {
+			t.Errorf("rejected spends = %d; want %d", rejected, spenders-100)
+		}
+		got, err := us.Find(jon.ID)
+		if err != nil {
+			t.Fatalf("us.Find() err = %s", err)
+		}
+		if got.Balance != 0 {
+			t.Errorf("user.Balance = %d; want %d", got.Balance, 0)
+		}
+	})
+}
@@ -0,0 +1,358 @@
+package signal
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Domain errors. Error maps them, and errors wrapping them, to status
+// codes, so handlers can add detail with fmt.Errorf("...: %w", err).
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrNotFound             = errors.New("not found")
+	ErrMethodNotAllowed     = errors.New("method not allowed")
+	ErrConflict             = errors.New("conflict")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrBodyTooLarge         = errors.New("request body too large")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrNotAcceptable        = errors.New("not acceptable")
+)
+
+var errorStatus = []struct {
+	err    error
+	status int
+}{
+	{ErrBadRequest, http.StatusBadRequest},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrMethodNotAllowed, http.StatusMethodNotAllowed},
+	{ErrConflict, http.StatusConflict},
+	{ErrPreconditionFailed, http.StatusPreconditionFailed},
+	{ErrBodyTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType},
+	{ErrNotAcceptable, http.StatusNotAcceptable},
+}
+
+// ValidationError reports input that was well formed but invalid. Fields
+// maps field names to what is wrong with them.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (ve *ValidationError) Error() string {
+	names := make([]string, 0, len(ve.Fields))
+	for name := range ve.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + ve.Fields[name]
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+// MaxBodyBytes is the largest request body Decode accepts.
+var MaxBodyBytes int64 = 1 << 20
+
+// LogError is called by Error with errors that aren't mapped to a status
+// code, before a generic 500 is sent to the client.
+var LogError = func(r *http.Request, err error) {
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+}
+
+// Content types supported by Respond.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeXML  = "application/xml"
+)
+
+// ErrorBody is the body of every error response, inside an envelope:
+//
+//	{"error": {"status": 404, "code": "not_found", "message": "..."}}
+type ErrorBody struct {
+	XMLName xml.Name          `json:"-" xml:"error"`
+	Status  int               `json:"status" xml:"status"`
+	Code    string            `json:"code" xml:"code"`
+	Message string            `json:"message" xml:"message"`
+	Fields  map[string]string `json:"fields,omitempty" xml:"-"`
+}
+
+// xmlErrorBody is how ErrorBody is encoded in XML, where maps aren't
+// supported. Fields are sorted by name:
+//
+//	<fields><field name="Age">must be between 0 and 150</field></fields>
+type xmlErrorBody struct {
+	XMLName xml.Name        `xml:"error"`
+	Status  int             `xml:"status"`
+	Code    string          `xml:"code"`
+	Message string          `xml:"message"`
+	Fields  []xmlFieldError `xml:"fields>field"`
+}
+
+type xmlFieldError struct {
+	Name    string `xml:"name,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (b ErrorBody) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	names := make([]string, 0, len(b.Fields))
+	for name := range b.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	v := xmlErrorBody{Status: b.Status, Code: b.Code, Message: b.Message}
+	for _, name := range names {
+		v.Fields = append(v.Fields, xmlFieldError{Name: name, Message: b.Fields[name]})
+	}
+	return e.Encode(v)
+}
+
+func (b *ErrorBody) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v xmlErrorBody
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*b = ErrorBody{XMLName: v.XMLName, Status: v.Status, Code: v.Code, Message: v.Message}
+	if len(v.Fields) > 0 {
+		b.Fields = make(map[string]string, len(v.Fields))
+		for _, f := range v.Fields {
+			b.Fields[f.Name] = f.Message
+		}
+	}
+	return nil
+}
+
+type errorEnvelope struct {
+	Error ErrorBody `json:"error"`
+}
+
+// Respond writes v with the status code, encoded in the format the
+// request's Accept header prefers. If the client accepts neither JSON nor
+// XML, it gets a 406 error instead. Responses are encoded before anything
+// is written, so encoding errors become a 500.
+func Respond(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	contentType, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		Error(w, r, notAcceptable())
+		return
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	body, err := encode(contentType, v)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+	write(w, status, contentType, body)
+}
+
+// Acceptable is middleware that responds with a 406 error, without calling
+// next, if the client accepts neither JSON nor XML. Handlers that change
+// data should be wrapped with it so that a request whose response can't
+// be sent doesn't change anything.
+func Acceptable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := negotiate(r.Header.Get("Accept")); !ok {
+			Error(w, r, notAcceptable())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func notAcceptable() error {
+	return fmt.Errorf("%w: supported types are %s and %s", ErrNotAcceptable, ContentTypeJSON, ContentTypeXML)
+}
+
+// Error responds with an error envelope. The status code comes from the
+// first of these that applies:
+//
+//   - err is a *ValidationError: 422, with the invalid fields listed.
+//   - err has a StatusCode() int method.
+//   - err is or wraps one of the Err* variables in this package.
+//   - Otherwise it is a 500 and the client gets a generic message; err is
+//     passed to LogError instead.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	body := ErrorBody{Status: http.StatusInternalServerError, Message: err.Error()}
+	var (
+		ve *ValidationError
+		sc interface{ StatusCode() int }
+	)
+	switch {
+	case errors.As(err, &ve):
+		body.Status = http.StatusUnprocessableEntity
+		body.Fields = ve.Fields
+	case errors.As(err, &sc):
+		body.Status = sc.StatusCode()
+	default:
+		for _, es := range errorStatus {
+			if errors.Is(err, es.err) {
+				body.Status = es.status
+				break
+			}
+		}
+	}
+	if body.Status == http.StatusInternalServerError {
+		if LogError != nil {
+			LogError(r, err)
+		}
+		body.Message = "internal server error"
+	}
+	body.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(body.Status)), " ", "_")
+
+	// Errors about the Accept header can't be sent in a format the client
+	// accepts, so they fall back to JSON.
+	contentType, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		contentType = ContentTypeJSON
+	}
+	var v interface{} = errorEnvelope{body}
+	if contentType == ContentTypeXML {
+		v = body
+	}
+	data, encErr := encode(contentType, v)
+	if encErr != nil {
+		// ErrorBody always encodes, so this can't happen.
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	write(w, body.Status, contentType, data)
+}
+
+// Decode reads the request's JSON body into v. The body must be no larger
+// than MaxBodyBytes, must only contain fields that v has, and must hold a
+// single JSON value. Errors wrap ErrBadRequest, ErrBodyTooLarge or
+// ErrUnsupportedMediaType, so they can be passed straight to Error.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaType != ContentTypeJSON {
+			return fmt.Errorf("%w: Content-Type must be %s", ErrUnsupportedMediaType, ContentTypeJSON)
+		}
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if err == nil {
+			return fmt.Errorf("%w: body must contain a single JSON value", ErrBadRequest)
+		}
+		return decodeError(err)
+	}
+	return nil
+}
+
+func decodeError(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		maxErr    *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		return fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, maxErr.Limit)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%w: malformed JSON at offset %d", ErrBadRequest, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%w: field %q must be a %s", ErrBadRequest, typeErr.Field, typeErr.Type)
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: body must not be empty", ErrBadRequest)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: malformed JSON", ErrBadRequest)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("%w: %s", ErrBadRequest, strings.TrimPrefix(err.Error(), "json: "))
+	default:
+		return fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+}
+
+// negotiate picks the content type to respond with from an Accept header.
+// Each supported type gets the quality of the most specific media range
+// that matches it, so "application/json;q=0, */*" refuses JSON even though
+// */* would allow it. JSON is preferred when the qualities are equal.
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return ContentTypeJSON, true
+	}
+	type quality struct {
+		q           float64
+		specificity int
+	}
+	qualities := make(map[string]quality)
+	set := func(ct string, q float64, specificity int) {
+		cur, ok := qualities[ct]
+		if !ok || specificity > cur.specificity || (specificity == cur.specificity && q > cur.q) {
+			qualities[ct] = quality{q, specificity}
+		}
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(qs, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "*/*":
+			set(ContentTypeJSON, q, 0)
+			set(ContentTypeXML, q, 0)
+		case "application/*":
+			set(ContentTypeJSON, q, 1)
+			set(ContentTypeXML, q, 1)
+		case ContentTypeJSON:
+			set(ContentTypeJSON, q, 2)
+		case ContentTypeXML, "text/xml":
+			set(ContentTypeXML, q, 2)
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, ct := range []string{ContentTypeJSON, ContentTypeXML} {
+		if q := qualities[ct].q; q > bestQ {
+			best, bestQ = ct, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+func encode(contentType string, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	switch contentType {
+	case ContentTypeXML:
+		buf.WriteString(xml.Header)
+		if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, fmt.Errorf("encoding XML response: %w", err)
+		}
+	default:
+		if err := json.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, fmt.Errorf("encoding JSON response: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func write(w http.ResponseWriter, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(body)
+}
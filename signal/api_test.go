@@ -0,0 +1,243 @@
+package signal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	p := Person{Age: 30, Name: "Bob Jones", Occupation: "Nurse"}
+	tests := map[string]struct {
+		accept   string
+		wantCode int
+		wantType string
+	}{
+		"no Accept":          {"", 200, ContentTypeJSON},
+		"json":               {"application/json", 200, ContentTypeJSON},
+		"any":                {"*/*", 200, ContentTypeJSON},
+		"xml":                {"application/xml", 200, ContentTypeXML},
+		"text xml":           {"text/xml", 200, ContentTypeXML},
+		"prefers xml":        {"application/json;q=0.5, application/xml", 200, ContentTypeXML},
+		"prefers json":       {"application/xml;q=0.9, application/json", 200, ContentTypeJSON},
+		"browser":            {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", 200, ContentTypeXML},
+		"unsupported":        {"text/html", 406, ContentTypeJSON},
+		"refuses everything": {"application/json;q=0", 406, ContentTypeJSON},
+		"refuses json":       {"application/json;q=0, */*", 200, ContentTypeXML},
+		"refuses both":       {"application/json;q=0, application/xml;q=0, */*", 406, ContentTypeJSON},
+		"any application":    {"application/*;q=0.5, application/xml;q=0.4", 200, ContentTypeJSON},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			Respond(w, r, http.StatusOK, p)
+			if w.Code != tc.wantCode {
+				t.Fatalf("Respond() status = %d; want %d", w.Code, tc.wantCode)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tc.wantType {
+				t.Errorf("Respond() Content-Type = %q; want %q", ct, tc.wantType)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var got Person
+			var err error
+			if tc.wantType == ContentTypeXML {
+				err = xml.Unmarshal(w.Body.Bytes(), &got)
+			} else {
+				err = json.Unmarshal(w.Body.Bytes(), &got)
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() err = %s; want nil", err)
+			}
+			if got != p {
+				t.Errorf("Respond() body = %+v; want %+v", got, p)
+			}
+		})
+	}
+
+	t.Run("no content", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		Respond(w, httptest.NewRequest(http.MethodDelete, "/", nil), http.StatusNoContent, nil)
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("Respond() = %d %q; want 204 with no body", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("encoding error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		logged := captureLog(t)
+		Respond(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, func() {})
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Respond() status = %d; want %d", w.Code, http.StatusInternalServerError)
+		}
+		if *logged == nil {
+			t.Errorf("LogError was not called; want the encoding error logged")
+		}
+	})
+}
+
+// captureLog replaces LogError for the rest of the test and returns a
+// pointer to the last error it was called with.
+func captureLog(t *testing.T) *error {
+	var logged error
+	orig := LogError
+	LogError = func(r *http.Request, err error) { logged = err }
+	t.Cleanup(func() { LogError = orig })
+	return &logged
+}
+
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "short and stout" }
+func (teapotError) StatusCode() int { return http.StatusTeapot }
+
+func TestError(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want ErrorBody
+	}{
+		"not found": {
+			fmt.Errorf("person 3: %w", ErrNotFound),
+			ErrorBody{Status: 404, Code: "not_found", Message: "person 3: not found"},
+		},
+		"method":       {ErrMethodNotAllowed, ErrorBody{Status: 405, Code: "method_not_allowed", Message: "method not allowed"}},
+		"conflict":     {ErrConflict, ErrorBody{Status: 409, Code: "conflict", Message: "conflict"}},
+		"precondition": {ErrPreconditionFailed, ErrorBody{Status: 412, Code: "precondition_failed", Message: "precondition failed"}},
+		"too large":    {ErrBodyTooLarge, ErrorBody{Status: 413, Code: "request_entity_too_large", Message: "request body too large"}},
+		"validation": {
+			fmt.Errorf("creating person: %w", &ValidationError{Fields: map[string]string{"name": "is required", "age": "must not be negative"}}),
+			ErrorBody{
+				Status:  422,
+				Code:    "unprocessable_entity",
+				Message: "creating person: invalid input: age: must not be negative; name: is required",
+				Fields:  map[string]string{"name": "is required", "age": "must not be negative"},
+			},
+		},
+		"status code": {teapotError{}, ErrorBody{Status: 418, Code: "i'm_a_teapot", Message: "short and stout"}},
+		"internal": {
+			errors.New("pq: connection refused"),
+			ErrorBody{Status: 500, Code: "internal_server_error", Message: "internal server error"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			logged := captureLog(t)
+			w := httptest.NewRecorder()
+			Error(w, httptest.NewRequest(http.MethodGet, "/", nil), tc.err)
+			if w.Code != tc.want.Status {
+				t.Errorf("Error() status = %d; want %d", w.Code, tc.want.Status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+				t.Errorf("Error() Content-Type = %q; want %q", ct, ContentTypeJSON)
+			}
+			var got struct {
+				Error ErrorBody `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() err = %s; want nil", err)
+			}
+			if !reflect.DeepEqual(got.Error, tc.want) {
+				t.Errorf("Error() body = %+v; want %+v", got.Error, tc.want)
+			}
+			if wantLogged := tc.want.Status == 500; (*logged != nil) != wantLogged {
+				t.Errorf("logged = %v; want logged %t", *logged, wantLogged)
+			}
+		})
+	}
+
+	t.Run("xml", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", ContentTypeXML)
+		Error(w, r, ErrNotFound)
+		var got ErrorBody
+		if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Unmarshal() err = %s; want nil", err)
+		}
+		if got.Status != 404 || got.Code != "not_found" {
+			t.Errorf("Error() body = %+v; want a not_found error", got)
+		}
+	})
+
+	t.Run("xml fields", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", ContentTypeXML)
+		Error(w, r, &ValidationError{Fields: map[string]string{"name": "is required", "age": "must not be negative"}})
+		wantXML := `<fields><field name="age">must not be negative</field><field name="name">is required</field></fields>`
+		if body := w.Body.String(); !strings.Contains(body, wantXML) {
+			t.Errorf("Error() body = %s; want it to contain %s", body, wantXML)
+		}
+		var got ErrorBody
+		if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Unmarshal() err = %s; want nil", err)
+		}
+		want := map[string]string{"name": "is required", "age": "must not be negative"}
+		if !reflect.DeepEqual(got.Fields, want) {
+			t.Errorf("Error() fields = %v; want %v", got.Fields, want)
+		}
+	})
+}
+
+func TestDecode(t *testing.T) {
+	type input struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	tests := map[string]struct {
+		contentType string
+		body        string
+		want        input
+		wantErr     error
+		wantMsg     string
+	}{
+		"valid":            {ContentTypeJSON, `{"name": "Bob", "age": 30}`, input{"Bob", 30}, nil, ""},
+		"charset":          {"application/json; charset=utf-8", `{"name": "Bob"}`, input{Name: "Bob"}, nil, ""},
+		"no content type":  {"", `{"age": 1}`, input{Age: 1}, nil, ""},
+		"wrong type":       {"text/plain", `{}`, input{}, ErrUnsupportedMediaType, "unsupported media type: Content-Type must be application/json"},
+		"empty":            {ContentTypeJSON, ``, input{}, ErrBadRequest, "bad request: body must not be empty"},
+		"malformed":        {ContentTypeJSON, `{"name": }`, input{}, ErrBadRequest, "bad request: malformed JSON at offset 10"},
+		"truncated":        {ContentTypeJSON, `{"name": "Bob"`, input{}, ErrBadRequest, "bad request: malformed JSON"},
+		"wrong field type": {ContentTypeJSON, `{"age": "old"}`, input{}, ErrBadRequest, `bad request: field "age" must be a int`},
+		"unknown field":    {ContentTypeJSON, `{"name": "Bob", "admin": true}`, input{}, ErrBadRequest, `bad request: unknown field "admin"`},
+		"trailing value":   {ContentTypeJSON, `{"name": "Bob"} {}`, input{}, ErrBadRequest, "bad request: body must contain a single JSON value"},
+		"trailing garbage": {ContentTypeJSON, `{"name": "Bob"} x`, input{}, ErrBadRequest, ""},
+		"too large": {
+			ContentTypeJSON, `{"name": "` + strings.Repeat("a", 100) + `"}`,
+			input{}, ErrBodyTooLarge, "request body too large: limit is 64 bytes",
+		},
+	}
+	orig := MaxBodyBytes
+	MaxBodyBytes = 64
+	defer func() { MaxBodyBytes = orig }()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			var got input
+			err := Decode(httptest.NewRecorder(), r, &got)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Decode() err = %v; want %v", err, tc.wantErr)
+			}
+			if tc.wantMsg != "" && err.Error() != tc.wantMsg {
+				t.Errorf("Decode() err = %q; want %q", err, tc.wantMsg)
+			}
+			if err == nil && got != tc.want {
+				t.Errorf("Decode() = %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package signal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/joncalhoun/twg/app/router"
+)
+
+const (
+	// DefaultPageSize is the number of people listed when the request
+	// doesn't set a limit, and MaxPageSize is the largest limit allowed.
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+
+	maxAge       = 150
+	maxFieldLen  = 100
+	peoplePrefix = "/people/"
+)
+
+// Server is a REST API for people:
+//
+//	GET    /people?occupation=&limit=&offset=
+//	POST   /people
+//	GET    /people/{id}
+//	PUT    /people/{id}
+//	PATCH  /people/{id}
+//	DELETE /people/{id}
+//
+// Responses for a single person have an ETag header, which differs for
+// the JSON and XML representations. PUT, PATCH and DELETE honor If-Match,
+// failing with 412 if the person has changed since the client fetched it
+// in either format, and GET honors If-None-Match.
+type Server struct {
+	// People stores the people served. If it is nil, people are kept in
+	// memory.
+	People PersonStore
+
+	router *router.Router
+	once   sync.Once
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(func() {
+		if s.People == nil {
+			s.People = &MemPersonStore{}
+		}
+		s.router = router.New()
+		s.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, fmt.Errorf("%s: %w", r.URL.Path, ErrNotFound))
+		})
+		s.router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, ErrMethodNotAllowed))
+		})
+		// Checking Accept up front means create, update and delete never
+		// change a person and then fail to send the response.
+		s.router.Use(Acceptable)
+		s.router.Get("/people", s.list)
+		s.router.Post("/people", s.create)
+		s.router.Get("/people/{id}", s.get)
+		s.router.Put("/people/{id}", s.replace)
+		s.router.Patch("/people/{id}", s.patch)
+		s.router.Delete("/people/{id}", s.delete)
+	})
+	s.router.ServeHTTP(w, r)
+}
+
+// PersonList is the response body for GET /people.
+type PersonList struct {
+	XMLName xml.Name `json:"-" xml:"people"`
+	People  []Person `json:"people" xml:"person"`
+	Total   int      `json:"total" xml:"total,attr"`
+	Offset  int      `json:"offset" xml:"offset,attr"`
+	Limit   int      `json:"limit" xml:"limit,attr"`
+}
+
+// personInput is the body of POST and PUT requests. IDs are assigned by
+// the server, so they aren't accepted.
+type personInput struct {
+	Age        int    `json:"Age"`
+	Name       string `json:"Name"`
+	Occupation string `json:"Occupation"`
+}
+
+// personPatch is the body of PATCH requests. Fields that are left out
+// aren't changed.
+type personPatch struct {
+	Age        *int    `json:"Age"`
+	Name       *string `json:"Name"`
+	Occupation *string `json:"Occupation"`
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, err := queryInt(q.Get("limit"), DefaultPageSize)
+	if err != nil || limit < 1 || limit > MaxPageSize {
+		Error(w, r, fmt.Errorf("%w: limit must be between 1 and %d", ErrBadRequest, MaxPageSize))
+		return
+	}
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		Error(w, r, fmt.Errorf("%w: offset must not be negative", ErrBadRequest))
+		return
+	}
+	people, total, err := s.People.List(PersonFilter{
+		Occupation: q.Get("occupation"),
+		Offset:     offset,
+		Limit:      limit,
+	})
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+	if people == nil {
+		people = []Person{}
+	}
+	Respond(w, r, http.StatusOK, PersonList{
+		People: people,
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	})
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var in personInput
+	if err := Decode(w, r, &in); err != nil {
+		Error(w, r, err)
+		return
+	}
+	p := Person{Age: in.Age, Name: in.Name, Occupation: in.Occupation}
+	if err := validate(&p); err != nil {
+		Error(w, r, err)
+		return
+	}
+	if err := s.People.Create(&p); err != nil {
+		Error(w, r, err)
+		return
+	}
+	w.Header().Set("Location", peoplePrefix+strconv.Itoa(p.ID))
+	respondPerson(w, r, http.StatusCreated, &p)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	contentType, ok := negotiate(r.Header.Get("Accept"))
+	if match := r.Header.Get("If-None-Match"); ok && match != "" && etagMatches(match, etag(p, contentType)) {
+		w.Header().Set("ETag", etag(p, contentType))
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondPerson(w, r, http.StatusOK, p)
+}
+
+func (s *Server) replace(w http.ResponseWriter, r *http.Request) {
+	current, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	var in personInput
+	if err := Decode(w, r, &in); err != nil {
+		Error(w, r, err)
+		return
+	}
+	p := Person{ID: current.ID, Age: in.Age, Name: in.Name, Occupation: in.Occupation}
+	s.update(w, r, current, &p)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request) {
+	current, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	var in personPatch
+	if err := Decode(w, r, &in); err != nil {
+		Error(w, r, err)
+		return
+	}
+	p := *current
+	if in.Age != nil {
+		p.Age = *in.Age
+	}
+	if in.Name != nil {
+		p.Name = *in.Name
+	}
+	if in.Occupation != nil {
+		p.Occupation = *in.Occupation
+	}
+	s.update(w, r, current, &p)
+}
+
+// update validates and stores p, which is a new version of current.
+func (s *Server) update(w http.ResponseWriter, r *http.Request, current, p *Person) {
+	version, ok := ifMatch(w, r, current)
+	if !ok {
+		return
+	}
+	if err := validate(p); err != nil {
+		Error(w, r, err)
+		return
+	}
+	// The store checks the version again in case the person changed since
+	// it was read above. Without If-Match, the version read above is used
+	// so that PATCH doesn't overwrite changes made in the meantime.
+	if version == 0 {
+		version = current.Version
+	}
+	if err := s.People.Update(p, version); err != nil {
+		Error(w, r, err)
+		return
+	}
+	respondPerson(w, r, http.StatusOK, p)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	current, ok := s.find(w, r)
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r, current)
+	if !ok {
+		return
+	}
+	if err := s.People.Delete(current.ID, version); err != nil {
+		Error(w, r, err)
+		return
+	}
+	Respond(w, r, http.StatusNoContent, nil)
+}
+
+// find returns the person with the ID in the request's path. If there
+// isn't one, it responds with an error and returns false.
+func (s *Server) find(w http.ResponseWriter, r *http.Request) (*Person, bool) {
+	param := router.Param(r, "id")
+	id, err := strconv.Atoi(param)
+	if err != nil || id < 1 {
+		Error(w, r, fmt.Errorf("person %q: %w", param, ErrNotFound))
+		return nil, false
+	}
+	p, err := s.People.Get(id)
+	if err != nil {
+		Error(w, r, err)
+		return nil, false
+	}
+	return p, true
+}
+
+func respondPerson(w http.ResponseWriter, r *http.Request, status int, p *Person) {
+	if contentType, ok := negotiate(r.Header.Get("Accept")); ok {
+		w.Header().Set("ETag", etag(p, contentType))
+	}
+	Respond(w, r, status, p)
+}
+
+// etag returns the ETag of p's representation in the content type. It is
+// a strong validator, so each representation has its own.
+func etag(p *Person, contentType string) string {
+	format := "json"
+	if contentType == ContentTypeXML {
+		format = "xml"
+	}
+	return `"` + strconv.Itoa(p.ID) + "-" + strconv.Itoa(p.Version) + "-" + format + `"`
+}
+
+// etagMatches reports whether header, an If-Match or If-None-Match value,
+// matches any of the ETags. Weak ETags match too, since the comparison is
+// only used to detect changes.
+func etagMatches(header string, etags ...string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" {
+			return true
+		}
+		for _, want := range etags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ifMatch checks the request's If-Match header against current. It
+// returns the version the client expects, or zero if the request has no
+// If-Match header. If the header doesn't match, it responds with 412 and
+// returns false.
+func ifMatch(w http.ResponseWriter, r *http.Request, current *Person) (int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	// Either representation identifies the version the client has.
+	if !etagMatches(header, etag(current, ContentTypeJSON), etag(current, ContentTypeXML)) {
+		Error(w, r, fmt.Errorf("person %d has changed: %w", current.ID, ErrPreconditionFailed))
+		return 0, false
+	}
+	return current.Version, true
+}
+
+func validate(p *Person) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Occupation = strings.TrimSpace(p.Occupation)
+	fields := make(map[string]string)
+	switch {
+	case p.Name == "":
+		fields["Name"] = "is required"
+	case utf8.RuneCountInString(p.Name) > maxFieldLen:
+		fields["Name"] = fmt.Sprintf("must be at most %d characters", maxFieldLen)
+	}
+	if utf8.RuneCountInString(p.Occupation) > maxFieldLen {
+		fields["Occupation"] = fmt.Sprintf("must be at most %d characters", maxFieldLen)
+	}
+	if p.Age < 0 || p.Age > maxAge {
+		fields["Age"] = fmt.Sprintf("must be between 0 and %d", maxAge)
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
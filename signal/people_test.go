@@ -0,0 +1,405 @@
+package signal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serve sends a request to h and returns the recorded response. headers
+// are pairs of keys and values.
+func serve(t *testing.T, h http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", ContentTypeJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func decodePerson(t *testing.T, w *httptest.ResponseRecorder) Person {
+	t.Helper()
+	var p Person
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("json.Unmarshal(%s) err = %s; want nil", w.Body.String(), err)
+	}
+	return p
+}
+
+func decodeErrorBody(t *testing.T, w *httptest.ResponseRecorder) ErrorBody {
+	t.Helper()
+	var body struct {
+		Error ErrorBody `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal(%s) err = %s; want nil", w.Body.String(), err)
+	}
+	return body.Error
+}
+
+func seed(t *testing.T, people ...Person) *Server {
+	t.Helper()
+	store := &MemPersonStore{}
+	for i := range people {
+		if err := store.Create(&people[i]); err != nil {
+			t.Fatalf("Create() err = %s; want nil", err)
+		}
+	}
+	return &Server{People: store}
+}
+
+func TestServer_create(t *testing.T) {
+	s := &Server{}
+	w := serve(t, s, http.MethodPost, "/people", `{"Name": " Bob Jones ", "Age": 30, "Occupation": "Nurse"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /people status = %d; want %d; body = %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	got := decodePerson(t, w)
+	want := Person{ID: 1, Age: 30, Name: "Bob Jones", Occupation: "Nurse"}
+	if got != want {
+		t.Errorf("POST /people body = %+v; want %+v", got, want)
+	}
+	if loc := w.Header().Get("Location"); loc != "/people/1" {
+		t.Errorf("Location = %q; want %q", loc, "/people/1")
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Errorf("ETag is missing")
+	}
+
+	tests := map[string]struct {
+		body       string
+		wantCode   int
+		wantFields map[string]string
+	}{
+		"missing name": {`{"Age": 30}`, 422, map[string]string{"Name": "is required"}},
+		"blank name":   {`{"Name": "   "}`, 422, map[string]string{"Name": "is required"}},
+		"long name":    {`{"Name": "` + strings.Repeat("a", 101) + `"}`, 422, map[string]string{"Name": "must be at most 100 characters"}},
+		"bad age": {`{"Name": "Bob", "Age": -1, "Occupation": "` + strings.Repeat("a", 101) + `"}`, 422, map[string]string{
+			"Age":        "must be between 0 and 150",
+			"Occupation": "must be at most 100 characters",
+		}},
+		"client id":     {`{"ID": 7, "Name": "Bob"}`, 400, nil},
+		"unknown field": {`{"Name": "Bob", "admin": true}`, 400, nil},
+		"malformed":     {`{"Name": `, 400, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := serve(t, s, http.MethodPost, "/people", tc.body)
+			if w.Code != tc.wantCode {
+				t.Fatalf("POST /people status = %d; want %d", w.Code, tc.wantCode)
+			}
+			body := decodeErrorBody(t, w)
+			if !reflect.DeepEqual(body.Fields, tc.wantFields) {
+				t.Errorf("error fields = %v; want %v", body.Fields, tc.wantFields)
+			}
+		})
+	}
+}
+
+func TestServer_get(t *testing.T) {
+	s := seed(t, Person{Name: "Bob Jones", Age: 30, Occupation: "Nurse"})
+
+	w := serve(t, s, http.MethodGet, "/people/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /people/1 status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+		t.Errorf("Content-Type = %q; want %q", ct, ContentTypeJSON)
+	}
+	want := Person{ID: 1, Name: "Bob Jones", Age: 30, Occupation: "Nurse"}
+	if got := decodePerson(t, w); got != want {
+		t.Errorf("GET /people/1 body = %+v; want %+v", got, want)
+	}
+	etag := w.Header().Get("ETag")
+	xmlTag := serve(t, s, http.MethodGet, "/people/1", "", "Accept", ContentTypeXML).Header().Get("ETag")
+	if xmlTag == "" || xmlTag == etag {
+		t.Errorf("XML ETag = %q, JSON ETag = %q; want a different ETag for each", xmlTag, etag)
+	}
+
+	tests := map[string]struct {
+		method   string
+		target   string
+		headers  []string
+		wantCode int
+	}{
+		"missing":          {"GET", "/people/2", nil, http.StatusNotFound},
+		"invalid id":       {"GET", "/people/bob", nil, http.StatusNotFound},
+		"zero id":          {"GET", "/people/0", nil, http.StatusNotFound},
+		"not modified":     {"GET", "/people/1", []string{"If-None-Match", etag}, http.StatusNotModified},
+		"other format":     {"GET", "/people/1", []string{"If-None-Match", etag, "Accept", ContentTypeXML}, http.StatusOK},
+		"modified":         {"GET", "/people/1", []string{"If-None-Match", `"1-0"`}, http.StatusOK},
+		"xml":              {"GET", "/people/1", []string{"Accept", ContentTypeXML}, http.StatusOK},
+		"not acceptable":   {"GET", "/people/1", []string{"Accept", "text/html"}, http.StatusNotAcceptable},
+		"wrong method":     {"POST", "/people/1", nil, http.StatusMethodNotAllowed},
+		"unknown resource": {"GET", "/pets/1", nil, http.StatusNotFound},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := serve(t, s, tc.method, tc.target, "", tc.headers...)
+			if w.Code != tc.wantCode {
+				t.Errorf("%s %s status = %d; want %d", tc.method, tc.target, w.Code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestServer_methodNotAllowed(t *testing.T) {
+	s := seed(t, Person{Name: "Bob Jones", Age: 30, Occupation: "Nurse"})
+	w := serve(t, s, http.MethodPost, "/people/1", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /people/1 status = %d; want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got, want := w.Header().Get("Allow"), "DELETE, GET, HEAD, PATCH, PUT"; got != want {
+		t.Errorf("Allow = %q; want %q", got, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+		t.Errorf("Content-Type = %q; want %q", ct, ContentTypeJSON)
+	}
+	if got := decodeErrorBody(t, w); got.Code != "method_not_allowed" {
+		t.Errorf("error code = %q; want %q", got.Code, "method_not_allowed")
+	}
+}
+
+func TestServer_list(t *testing.T) {
+	s := seed(t,
+		Person{Name: "Alice", Occupation: "Nurse"},
+		Person{Name: "Bob", Occupation: "Doctor"},
+		Person{Name: "Carol", Occupation: "nurse"},
+		Person{Name: "Dan", Occupation: "Nurse"},
+		Person{Name: "Eve", Occupation: "Pilot"},
+	)
+	tests := map[string]struct {
+		query     string
+		wantCode  int
+		wantNames []string
+		wantTotal int
+	}{
+		"all":             {"", 200, []string{"Alice", "Bob", "Carol", "Dan", "Eve"}, 5},
+		"occupation":      {"?occupation=NURSE", 200, []string{"Alice", "Carol", "Dan"}, 3},
+		"no matches":      {"?occupation=Chef", 200, []string{}, 0},
+		"first page":      {"?limit=2", 200, []string{"Alice", "Bob"}, 5},
+		"second page":     {"?limit=2&offset=2", 200, []string{"Carol", "Dan"}, 5},
+		"last page":       {"?limit=2&offset=4", 200, []string{"Eve"}, 5},
+		"past the end":    {"?offset=10", 200, []string{}, 5},
+		"filtered page":   {"?occupation=nurse&limit=1&offset=1", 200, []string{"Carol"}, 3},
+		"zero limit":      {"?limit=0", 400, nil, 0},
+		"large limit":     {"?limit=101", 400, nil, 0},
+		"bad limit":       {"?limit=ten", 400, nil, 0},
+		"negative offset": {"?offset=-1", 400, nil, 0},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := serve(t, s, http.MethodGet, "/people"+tc.query, "")
+			if w.Code != tc.wantCode {
+				t.Fatalf("GET /people%s status = %d; want %d", tc.query, w.Code, tc.wantCode)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var list PersonList
+			if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+				t.Fatalf("json.Unmarshal() err = %s; want nil", err)
+			}
+			names := []string{}
+			for _, p := range list.People {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, tc.wantNames) {
+				t.Errorf("names = %v; want %v", names, tc.wantNames)
+			}
+			if list.Total != tc.wantTotal {
+				t.Errorf("total = %d; want %d", list.Total, tc.wantTotal)
+			}
+			if !strings.Contains(w.Body.String(), `"people":[`) {
+				t.Errorf("body = %s; want people to be an array", w.Body.String())
+			}
+		})
+	}
+
+	t.Run("xml", func(t *testing.T) {
+		w := serve(t, s, http.MethodGet, "/people?limit=2", "", "Accept", ContentTypeXML)
+		var list PersonList
+		if err := xml.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("xml.Unmarshal() err = %s; want nil", err)
+		}
+		if len(list.People) != 2 || list.Total != 5 || list.Limit != 2 {
+			t.Errorf("list = %+v; want 2 of 5 people", list)
+		}
+	})
+}
+
+func TestServer_update(t *testing.T) {
+	newServer := func(t *testing.T) (*Server, string) {
+		s := seed(t, Person{Name: "Bob Jones", Age: 30, Occupation: "Nurse"})
+		return s, serve(t, s, http.MethodGet, "/people/1", "").Header().Get("ETag")
+	}
+
+	t.Run("put", func(t *testing.T) {
+		s, etag := newServer(t)
+		w := serve(t, s, http.MethodPut, "/people/1", `{"Name": "Robert Jones", "Age": 31}`, "If-Match", etag)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT /people/1 status = %d; want %d; body = %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		want := Person{ID: 1, Name: "Robert Jones", Age: 31}
+		if got := decodePerson(t, w); got != want {
+			t.Errorf("PUT /people/1 body = %+v; want %+v", got, want)
+		}
+		newTag := w.Header().Get("ETag")
+		if newTag == "" || newTag == etag {
+			t.Errorf("ETag = %q; want a new ETag", newTag)
+		}
+		if got := decodePerson(t, serve(t, s, http.MethodGet, "/people/1", "")); got != want {
+			t.Errorf("GET /people/1 after PUT = %+v; want %+v", got, want)
+		}
+
+		// The original ETag is now stale.
+		w = serve(t, s, http.MethodPut, "/people/1", `{"Name": "Bobby"}`, "If-Match", etag)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("PUT /people/1 with a stale ETag status = %d; want %d", w.Code, http.StatusPreconditionFailed)
+		}
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		s, _ := newServer(t)
+		w := serve(t, s, http.MethodPatch, "/people/1", `{"Age": 31}`)
+		want := Person{ID: 1, Name: "Bob Jones", Age: 31, Occupation: "Nurse"}
+		if got := decodePerson(t, w); got != want {
+			t.Errorf("PATCH /people/1 body = %+v; want %+v", got, want)
+		}
+		w = serve(t, s, http.MethodPatch, "/people/1", `{"Occupation": ""}`)
+		want.Occupation = ""
+		if got := decodePerson(t, w); got != want {
+			t.Errorf("PATCH /people/1 body = %+v; want %+v", got, want)
+		}
+	})
+
+	tests := map[string]struct {
+		method   string
+		target   string
+		body     string
+		ifMatch  func(etag string) string
+		wantCode int
+	}{
+		"put stale":         {http.MethodPut, "/people/1", `{"Name": "Bob"}`, func(string) string { return `"1-9"` }, 412},
+		"put any":           {http.MethodPut, "/people/1", `{"Name": "Bob"}`, func(string) string { return "*" }, 200},
+		"put weak":          {http.MethodPut, "/people/1", `{"Name": "Bob"}`, func(e string) string { return "W/" + e }, 200},
+		"put one of":        {http.MethodPut, "/people/1", `{"Name": "Bob"}`, func(e string) string { return `"x", ` + e }, 200},
+		"put xml etag":      {http.MethodPut, "/people/1", `{"Name": "Bob"}`, func(e string) string { return strings.Replace(e, "json", "xml", 1) }, 200},
+		"put invalid":       {http.MethodPut, "/people/1", `{"Age": 30}`, nil, 422},
+		"put missing":       {http.MethodPut, "/people/2", `{"Name": "Bob"}`, nil, 404},
+		"patch stale":       {http.MethodPatch, "/people/1", `{"Age": 1}`, func(string) string { return `"1-9"` }, 412},
+		"patch invalid":     {http.MethodPatch, "/people/1", `{"Name": ""}`, nil, 422},
+		"patch wrong type":  {http.MethodPatch, "/people/1", `{"Age": "old"}`, nil, 400},
+		"patch unknown":     {http.MethodPatch, "/people/1", `{"ID": 2}`, nil, 400},
+		"patch missing":     {http.MethodPatch, "/people/2", `{"Age": 1}`, nil, 404},
+		"delete stale":      {http.MethodDelete, "/people/1", "", func(string) string { return `"1-9"` }, 412},
+		"delete":            {http.MethodDelete, "/people/1", "", nil, 204},
+		"delete if matches": {http.MethodDelete, "/people/1", "", func(e string) string { return e }, 204},
+		"delete missing":    {http.MethodDelete, "/people/2", "", nil, 404},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, etag := newServer(t)
+			var headers []string
+			if tc.ifMatch != nil {
+				headers = []string{"If-Match", tc.ifMatch(etag)}
+			}
+			w := serve(t, s, tc.method, tc.target, tc.body, headers...)
+			if w.Code != tc.wantCode {
+				t.Fatalf("%s %s status = %d; want %d; body = %s", tc.method, tc.target, w.Code, tc.wantCode, w.Body.String())
+			}
+
+			after := serve(t, s, http.MethodGet, "/people/1", "")
+			switch {
+			case tc.method == http.MethodDelete && tc.wantCode == http.StatusNoContent:
+				if after.Code != http.StatusNotFound {
+					t.Errorf("GET /people/1 after DELETE status = %d; want %d", after.Code, http.StatusNotFound)
+				}
+			case tc.wantCode != http.StatusOK:
+				// Failed requests must not change the person.
+				if got := after.Header().Get("ETag"); got != etag {
+					t.Errorf("ETag after failed %s = %q; want %q", tc.method, got, etag)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_notAcceptable(t *testing.T) {
+	tests := map[string]struct {
+		method string
+		target string
+		body   string
+	}{
+		"post":   {http.MethodPost, "/people", `{"Name": "Alice"}`},
+		"put":    {http.MethodPut, "/people/1", `{"Name": "Robert"}`},
+		"patch":  {http.MethodPatch, "/people/1", `{"Age": 31}`},
+		"delete": {http.MethodDelete, "/people/1", ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := &MemPersonStore{}
+			bob := Person{Name: "Bob", Age: 30}
+			if err := store.Create(&bob); err != nil {
+				t.Fatalf("Create() err = %s; want nil", err)
+			}
+			s := &Server{People: store}
+			w := serve(t, s, tc.method, tc.target, tc.body, "Accept", "text/plain")
+			if w.Code != http.StatusNotAcceptable {
+				t.Fatalf("%s %s status = %d; want %d", tc.method, tc.target, w.Code, http.StatusNotAcceptable)
+			}
+			if got := w.Header().Get("Location"); got != "" {
+				t.Errorf("Location = %q; want none", got)
+			}
+			people, total, err := store.List(PersonFilter{Limit: MaxPageSize})
+			if err != nil {
+				t.Fatalf("List() err = %s; want nil", err)
+			}
+			if total != 1 || people[0] != bob {
+				t.Errorf("List() = %+v; want only %+v", people, bob)
+			}
+		})
+	}
+}
+
+func TestMemPersonStore_versions(t *testing.T) {
+	var store MemPersonStore
+	p := Person{Name: "Bob"}
+	if err := store.Create(&p); err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	if p.ID != 1 || p.Version != 1 {
+		t.Fatalf("Create() = %+v; want ID 1 at version 1", p)
+	}
+	p.Name = "Robert"
+	if err := store.Update(&p, 1); err != nil {
+		t.Fatalf("Update() err = %s; want nil", err)
+	}
+	if p.Version != 2 {
+		t.Errorf("Version = %d; want 2", p.Version)
+	}
+	if err := store.Update(&p, 1); err == nil {
+		t.Errorf("Update() at a stale version err = nil; want an error")
+	}
+	if err := store.Delete(1, 1); err == nil {
+		t.Errorf("Delete() at a stale version err = nil; want an error")
+	}
+	if err := store.Delete(1, 0); err != nil {
+		t.Errorf("Delete() err = %s; want nil", err)
+	}
+	if _, err := store.Get(1); err == nil {
+		t.Errorf("Get() after Delete() err = nil; want an error")
+	}
+}
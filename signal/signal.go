@@ -1,14 +1,17 @@
 package signal
 
 import (
-	"encoding/json"
 	"net/http"
 )
 
 type Person struct {
-	Age        int
-	Name       string
-	Occupation string
+	ID         int    `json:"ID,omitempty" xml:"id"`
+	Age        int    `json:"Age" xml:"age"`
+	Name       string `json:"Name" xml:"name"`
+	Occupation string `json:"Occupation" xml:"occupation"`
+	// Version is incremented every time the person is updated. It is
+	// sent to clients in the ETag header rather than the body.
+	Version int `json:"-" xml:"-"`
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
@@ -17,12 +20,5 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		Name:       "Bob Jones",
 		Occupation: "Nurse",
 	}
-	data, err := json.Marshal(p)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(data)
+	Respond(w, r, http.StatusOK, p)
 }
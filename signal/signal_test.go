@@ -44,3 +44,15 @@ func TestHandler(t *testing.T) {
 		t.Errorf("person.Name = %s; want %s", p.Name, wantName)
 	}
 }
+
+func TestHandler_body(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Handler(w, r)
+
+	// Clients already depend on these keys, so the format must not change.
+	want := `{"Age":30,"Name":"Bob Jones","Occupation":"Nurse"}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Handler() body = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+package signal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PersonFilter selects a page of people for PersonStore.List.
+type PersonFilter struct {
+	// Occupation, if set, only matches people with that occupation,
+	// ignoring case.
+	Occupation string
+	Offset     int
+	// Limit is the most people to return. Zero means no limit.
+	Limit int
+}
+
+// PersonStore persists people. Errors wrap ErrNotFound for missing people
+// and ErrPreconditionFailed for version mismatches, so handlers can pass
+// them straight to Error.
+type PersonStore interface {
+	// List returns the page of people matching f, ordered by ID, along
+	// with the total number of matches.
+	List(f PersonFilter) ([]Person, int, error)
+	Get(id int) (*Person, error)
+	// Create sets the person's ID and Version.
+	Create(p *Person) error
+	// Update replaces the person with p.ID and increments p.Version. If
+	// version isn't zero, the update only happens if the stored person
+	// is at that version.
+	Update(p *Person, version int) error
+	// Delete removes the person. If version isn't zero, it only happens
+	// if the stored person is at that version.
+	Delete(id, version int) error
+}
+
+// MemPersonStore stores people in memory. The zero value is ready to use
+// and it is safe for concurrent use.
+type MemPersonStore struct {
+	mu     sync.Mutex
+	people map[int]Person
+	nextID int
+}
+
+func (mps *MemPersonStore) List(f PersonFilter) ([]Person, int, error) {
+	mps.mu.Lock()
+	defer mps.mu.Unlock()
+	var matches []Person
+	for _, p := range mps.people {
+		if f.Occupation == "" || strings.EqualFold(p.Occupation, f.Occupation) {
+			matches = append(matches, p)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID < matches[j].ID
+	})
+	total := len(matches)
+	if f.Offset >= total {
+		return []Person{}, total, nil
+	}
+	matches = matches[f.Offset:]
+	if f.Limit > 0 && f.Limit < len(matches) {
+		matches = matches[:f.Limit]
+	}
+	return matches, total, nil
+}
+
+func (mps *MemPersonStore) Get(id int) (*Person, error) {
+	mps.mu.Lock()
+	defer mps.mu.Unlock()
+	p, ok := mps.people[id]
+	if !ok {
+		return nil, fmt.Errorf("person %d: %w", id, ErrNotFound)
+	}
+	return &p, nil
+}
+
+func (mps *MemPersonStore) Create(p *Person) error {
+	mps.mu.Lock()
+	defer mps.mu.Unlock()
+	if mps.people == nil {
+		mps.people = make(map[int]Person)
+	}
+	mps.nextID++
+	p.ID = mps.nextID
+	p.Version = 1
+	mps.people[p.ID] = *p
+	return nil
+}
+
+func (mps *MemPersonStore) Update(p *Person, version int) error {
+	mps.mu.Lock()
+	defer mps.mu.Unlock()
+	current, err := mps.check(p.ID, version)
+	if err != nil {
+		return err
+	}
+	p.Version = current.Version + 1
+	mps.people[p.ID] = *p
+	return nil
+}
+
+func (mps *MemPersonStore) Delete(id, version int) error {
+	mps.mu.Lock()
+	defer mps.mu.Unlock()
+	if _, err := mps.check(id, version); err != nil {
+		return err
+	}
+	delete(mps.people, id)
+	return nil
+}
+
+// check returns the stored person, or an error if they don't exist or
+// aren't at version. mps.mu must be held.
+func (mps *MemPersonStore) check(id, version int) (Person, error) {
+	current, ok := mps.people[id]
+	if !ok {
+		return Person{}, fmt.Errorf("person %d: %w", id, ErrNotFound)
+	}
+	if version != 0 && current.Version != version {
+		return Person{}, fmt.Errorf("person %d is at version %d, not %d: %w", id, current.Version, version, ErrPreconditionFailed)
+	}
+	return current, nil
+}
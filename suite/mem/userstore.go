@@ -0,0 +1,67 @@
+package mem
+
+import (
+	"sync"
+
+	"github.com/joncalhoun/twg/suite"
+)
+
+// UserStore is an in-memory suite.UserStore. It is safe for concurrent
+// use. The zero value is an empty store ready to use.
+type UserStore struct {
+	mu     sync.Mutex
+	byID   map[int]suite.User
+	nextID int
+}
+
+// Create stores a copy of the user and sets its ID. ErrEmailTaken is
+// returned if another user already has the same email address.
+func (us *UserStore) Create(user *suite.User) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.byID == nil {
+		us.byID = make(map[int]suite.User)
+	}
+	for _, existing := range us.byID {
+		if existing.Email == user.Email {
+			return suite.ErrEmailTaken
+		}
+	}
+	us.nextID++
+	user.ID = us.nextID
+	us.byID[user.ID] = *user
+	return nil
+}
+
+// ByID returns a copy of the user with the provided ID or ErrNotFound.
+func (us *UserStore) ByID(id int) (*suite.User, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	user, ok := us.byID[id]
+	if !ok {
+		return nil, suite.ErrNotFound
+	}
+	return &user, nil
+}
+
+// ByEmail returns a copy of the user with the provided email address or
+// ErrNotFound.
+func (us *UserStore) ByEmail(email string) (*suite.User, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	for _, user := range us.byID {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, suite.ErrNotFound
+}
+
+// Delete removes the user with the same ID as user. Deleting a user that
+// doesn't exist is not an error.
+func (us *UserStore) Delete(user *suite.User) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	delete(us.byID, user.ID)
+	return nil
+}
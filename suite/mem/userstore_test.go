@@ -0,0 +1,21 @@
+package mem_test
+
+import (
+	"testing"
+
+	"github.com/joncalhoun/twg/suite"
+	"github.com/joncalhoun/twg/suite/mem"
+	"github.com/joncalhoun/twg/suite/suitetest"
+)
+
+var _ suite.UserStore = &mem.UserStore{}
+
+func TestUserStore(t *testing.T) {
+	tests := suitetest.UserStoreSuite{
+		New: func(t *testing.T) suite.UserStore {
+			return &mem.UserStore{}
+		},
+		Parallel: true,
+	}
+	tests.All(t)
+}
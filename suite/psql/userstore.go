@@ -0,0 +1,81 @@
+package psql
+
+import (
+	"database/sql"
+
+	pgerr "github.com/joncalhoun/twg/psql"
+	"github.com/joncalhoun/twg/suite"
+	"github.com/pkg/errors"
+)
+
+// UserStore is a suite.UserStore backed by Postgres. It expects a users
+// table with a UNIQUE constraint on the email column, eg:
+//
+//	CREATE TABLE users (
+//		id SERIAL PRIMARY KEY,
+//		email TEXT UNIQUE NOT NULL
+//	);
+type UserStore struct {
+	sql interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+		QueryRow(query string, args ...interface{}) *sql.Row
+	}
+}
+
+// NewUserStore returns a UserStore using db.
+func NewUserStore(db *sql.DB) *UserStore {
+	return &UserStore{
+		sql: db,
+	}
+}
+
+// Create will create a new user in the DB and set the user's ID.
+// ErrEmailTaken is returned if the email address is already in use.
+func (us *UserStore) Create(user *suite.User) error {
+	const query = `INSERT INTO users (email) VALUES ($1) RETURNING id`
+	err := us.sql.QueryRow(query, user.Email).Scan(&user.ID)
+	if err != nil {
+		if pgerr.EmailTaken(err) {
+			return suite.ErrEmailTaken
+		}
+		return errors.Wrap(err, "psql: error creating new user")
+	}
+	return nil
+}
+
+// ByID will retrieve a user with the provided ID or return ErrNotFound.
+func (us *UserStore) ByID(id int) (*suite.User, error) {
+	const query = `SELECT id, email FROM users WHERE id=$1;`
+	return us.find(query, id)
+}
+
+// ByEmail will retrieve a user with the provided email address or return
+// ErrNotFound.
+func (us *UserStore) ByEmail(email string) (*suite.User, error) {
+	const query = `SELECT id, email FROM users WHERE email=$1;`
+	return us.find(query, email)
+}
+
+func (us *UserStore) find(query string, arg interface{}) (*suite.User, error) {
+	var user suite.User
+	err := us.sql.QueryRow(query, arg).Scan(&user.ID, &user.Email)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, suite.ErrNotFound
+	case nil:
+		return &user, nil
+	default:
+		return nil, errors.Wrap(err, "psql: error querying for user")
+	}
+}
+
+// Delete will delete the user from the DB. Deleting a user that doesn't
+// exist is not an error.
+func (us *UserStore) Delete(user *suite.User) error {
+	const query = `DELETE FROM users WHERE id=$1;`
+	_, err := us.sql.Exec(query, user.ID)
+	if err != nil {
+		return errors.Wrap(err, "psql: error deleting user")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package psql_test
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/joncalhoun/twg/psql/psqltest"
+	"github.com/joncalhoun/twg/suite"
+	"github.com/joncalhoun/twg/suite/psql"
+	"github.com/joncalhoun/twg/suite/suitetest"
+)
+
+var _ suite.UserStore = &psql.UserStore{}
+
+const createUserTable = `CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL
+);`
+
+var (
+	dsn string
+	db  *sql.DB
+)
+
+func init() {
+	flag.StringVar(&dsn, "dsn", os.Getenv(psqltest.EnvDSN), "Postgres DSN to run the integration tests against. Defaults to the "+psqltest.EnvDSN+" environment variable. If neither is set the tests are skipped.")
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	var (
+		teardown func() error
+		err      error
+	)
+	db, teardown, err = psqltest.OpenDSN(dsn, createUserTable)
+	if errors.Is(err, psqltest.ErrUnavailable) {
+		// db stays nil, so TestUserStore is skipped.
+		return m.Run()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "psqltest.OpenDSN() err = %s\n", err)
+		return 1
+	}
+	code := m.Run()
+	if err := teardown(); err != nil {
+		fmt.Fprintf(os.Stderr, "teardown err = %s\n", err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+func TestUserStore(t *testing.T) {
+	if db == nil {
+		t.Skip("Postgres is unavailable; set -dsn or " + psqltest.EnvDSN + " to a reachable server to run")
+	}
+	tests := suitetest.UserStoreSuite{
+		UserStore: psql.NewUserStore(db),
+		BeforeEach: func() {
+			_, err := db.Exec(`TRUNCATE users;`)
+			if err != nil {
+				t.Errorf("TRUNCATE users err = %s", err)
+			}
+		},
+	}
+	tests.All(t)
+}
@@ -4,27 +4,47 @@ import (
 	"github.com/joncalhoun/twg/suite"
 )
 
-type UserStore struct{}
+// UserStore is the smallest suite.UserStore that meets the core suitetest
+// contract. It doesn't check that emails are unique and isn't safe for
+// concurrent use, so it doesn't support the suitetest.UniqueEmails or
+// suitetest.Concurrency capabilities. See the suite/mem package for an
+// implementation that does.
+type UserStore struct {
+	users  []suite.User
+	nextID int
+}
 
 func (us *UserStore) Create(user *suite.User) error {
-	user.ID = 123
+	us.nextID++
+	user.ID = us.nextID
+	us.users = append(us.users, *user)
 	return nil
 }
 
 func (us *UserStore) ByID(id int) (*suite.User, error) {
-	if id == 123 {
-		return nil, suite.ErrNotFound
+	for _, user := range us.users {
+		if user.ID == id {
+			return &user, nil
+		}
 	}
-	return &suite.User{
-		ID:    1,
-		Email: "test@test.com",
-	}, nil
+	return nil, suite.ErrNotFound
 }
 
 func (us *UserStore) ByEmail(email string) (*suite.User, error) {
-	return nil, nil
+	for _, user := range us.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, suite.ErrNotFound
 }
 
-func (us *UserStore) Delete(*suite.User) error {
+func (us *UserStore) Delete(user *suite.User) error {
+	for i, existing := range us.users {
+		if existing.ID == user.ID {
+			us.users = append(us.users[:i], us.users[i+1:]...)
+			return nil
+		}
+	}
 	return nil
 }
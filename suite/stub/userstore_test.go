@@ -11,14 +11,10 @@ import (
 var _ suite.UserStore = &stub.UserStore{}
 
 func TestUserStore(t *testing.T) {
-	us := &stub.UserStore{}
-	suitetest.UserStore(t, us, nil, nil)
-}
-
-func TestUserStore_withStruct(t *testing.T) {
 	us := &stub.UserStore{}
 	tests := suitetest.UserStoreSuite{
 		UserStore: us,
+		Skip:      []suitetest.Capability{suitetest.UniqueEmails, suitetest.Concurrency},
 	}
 	tests.All(t)
 }
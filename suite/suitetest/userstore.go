@@ -1,67 +1,275 @@
 package suitetest
 
 import (
+	"errors"
+	"sync"
 	"testing"
 
+	"github.com/joncalhoun/twg/contract"
+	"github.com/joncalhoun/twg/gen"
 	"github.com/joncalhoun/twg/suite"
 )
 
+// Capability is an optional behavior of a UserStore. Implementations that
+// don't support a capability can list it in UserStoreSuite.Skip and any
+// tests that depend on it will be skipped.
+type Capability = contract.Capability
+
+const (
+	// Concurrency means the UserStore is safe for concurrent use.
+	Concurrency Capability = "concurrency"
+	// UniqueEmails means Create returns ErrEmailTaken when another user is
+	// already using the email address.
+	UniqueEmails Capability = "unique emails"
+)
+
+// UserStoreSuite tests that a suite.UserStore implementation meets the
+// contract expected of it. BeforeEach and AfterEach, if set, are called
+// before and after every subtest.
 type UserStoreSuite struct {
 	suite.UserStore
 
+	// New, if set, is used instead of UserStore to create a fresh UserStore
+	// for every subtest.
+	New func(t *testing.T) suite.UserStore
+
 	BeforeEach func()
 	AfterEach  func()
+
+	// Skip lists optional capabilities the UserStore doesn't support.
+	Skip []Capability
+
+	// Parallel runs the subtests in parallel. Only use it if the UserStore
+	// is safe for concurrent use, or if New returns a new one each time,
+	// and BeforeEach and AfterEach don't affect other subtests.
+	Parallel bool
+}
+
+var userStoreTests = []contract.Test{
+	userStoreTest("Create", testCreate),
+	userStoreTest("ByID", testByID),
+	userStoreTest("ByEmail", testByEmail),
+	userStoreTest("Delete", testDelete),
+	userStoreTest("Create email taken", testCreateEmailTaken, UniqueEmails),
+	userStoreTest("Delete frees email", testDeleteFreesEmail, UniqueEmails),
+	userStoreTest("concurrent Create", testConcurrentCreate, Concurrency),
+	userStoreTest("concurrent Create email taken", testConcurrentCreateEmailTaken, Concurrency, UniqueEmails),
 }
 
+func userStoreTest(name string, fn func(*testing.T, suite.UserStore), requires ...Capability) contract.Test {
+	return contract.Test{
+		Name:     name,
+		Requires: requires,
+		Fn: func(t *testing.T, impl interface{}) {
+			fn(t, impl.(suite.UserStore))
+		},
+	}
+}
+
+// All runs every test in the suite.
 func (uss *UserStoreSuite) All(t *testing.T) {
-	UserStore(t, uss.UserStore, uss.BeforeEach, uss.AfterEach)
+	s := contract.Suite{
+		New: func(t *testing.T) interface{} {
+			if uss.New != nil {
+				return uss.New(t)
+			}
+			return uss.UserStore
+		},
+		Skip:     uss.Skip,
+		Parallel: uss.Parallel,
+	}
+	if uss.BeforeEach != nil {
+		s.BeforeEach = func(*testing.T, interface{}) { uss.BeforeEach() }
+	}
+	if uss.AfterEach != nil {
+		s.AfterEach = func(*testing.T, interface{}) { uss.AfterEach() }
+	}
+	s.Run(t, userStoreTests)
 }
 
-// suitetest.UserStore
+// UserStore runs the full suite of tests against us. It is equivalent to
+// running All on a UserStoreSuite with the same values.
 func UserStore(t *testing.T, us suite.UserStore, beforeEach, afterEach func()) {
-	_, err := us.ByID(123)
-	if err != suite.ErrNotFound {
-		t.Errorf("ByID(123) err = nil; want ErrNotFound")
+	uss := UserStoreSuite{
+		UserStore:  us,
+		BeforeEach: beforeEach,
+		AfterEach:  afterEach,
+	}
+	uss.All(t)
+}
+
+// create is a helper that creates a user with a unique email address and
+// deletes it when the test completes.
+func create(t *testing.T, us suite.UserStore) *suite.User {
+	t.Helper()
+	user := &suite.User{
+		Email: gen.Email(),
+	}
+	err := us.Create(user)
+	if err != nil {
+		t.Fatalf("Create() err = %s; want nil", err)
+	}
+	t.Cleanup(func() {
+		us.Delete(user)
+	})
+	return user
+}
+
+func testCreate(t *testing.T, us suite.UserStore) {
+	a := create(t, us)
+	if a.ID <= 0 {
+		t.Errorf("Create() user.ID = %d; want a positive value", a.ID)
+	}
+	b := create(t, us)
+	if a.ID == b.ID {
+		t.Errorf("Create() user.ID = %d for two users; want unique IDs", a.ID)
+	}
+}
+
+func testByID(t *testing.T, us suite.UserStore) {
+	want := create(t, us)
+	got, err := us.ByID(want.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %s; want nil", err)
+	}
+	if got == nil || *got != *want {
+		t.Errorf("ByID() = %+v; want %+v", got, want)
+	}
+
+	_, err = us.ByID(want.ID + 1000)
+	if !errors.Is(err, suite.ErrNotFound) {
+		t.Errorf("ByID(missing) err = %v; want %v", err, suite.ErrNotFound)
+	}
+}
+
+func testByEmail(t *testing.T, us suite.UserStore) {
+	want := create(t, us)
+	got, err := us.ByEmail(want.Email)
+	if err != nil {
+		t.Fatalf("ByEmail() err = %s; want nil", err)
+	}
+	if got == nil || *got != *want {
+		t.Errorf("ByEmail() = %+v; want %+v", got, want)
+	}
+
+	_, err = us.ByEmail(gen.Email())
+	if !errors.Is(err, suite.ErrNotFound) {
+		t.Errorf("ByEmail(missing) err = %v; want %v", err, suite.ErrNotFound)
+	}
+}
+
+func testDelete(t *testing.T, us suite.UserStore) {
+	user := create(t, us)
+	err := us.Delete(user)
+	if err != nil {
+		t.Fatalf("Delete() err = %s; want nil", err)
+	}
+	_, err = us.ByID(user.ID)
+	if !errors.Is(err, suite.ErrNotFound) {
+		t.Errorf("ByID() after Delete() err = %v; want %v", err, suite.ErrNotFound)
+	}
+	_, err = us.ByEmail(user.Email)
+	if !errors.Is(err, suite.ErrNotFound) {
+		t.Errorf("ByEmail() after Delete() err = %v; want %v", err, suite.ErrNotFound)
+	}
+}
+
+func testCreateEmailTaken(t *testing.T, us suite.UserStore) {
+	existing := create(t, us)
+	user := &suite.User{
+		Email: existing.Email,
+	}
+	err := us.Create(user)
+	if !errors.Is(err, suite.ErrEmailTaken) {
+		t.Errorf("Create() err = %v; want %v", err, suite.ErrEmailTaken)
+	}
+}
+
+func testDeleteFreesEmail(t *testing.T, us suite.UserStore) {
+	user := create(t, us)
+	err := us.Delete(user)
+	if err != nil {
+		t.Fatalf("Delete() err = %s; want nil", err)
+	}
+	again := &suite.User{
+		Email: user.Email,
+	}
+	err = us.Create(again)
+	if err != nil {
+		t.Fatalf("Create() with a deleted user's email err = %s; want nil", err)
 	}
+	us.Delete(again)
+}
 
-	t.Run("create", func(t *testing.T) {
-		user := &suite.User{
-			Email: "jon@calhoun.io",
+func testConcurrentCreate(t *testing.T, us suite.UserStore) {
+	const n = 20
+	users := make([]*suite.User, n)
+	var wg sync.WaitGroup
+	for i := range users {
+		users[i] = &suite.User{
+			Email: gen.Email(),
+		}
+		wg.Add(1)
+		go func(user *suite.User) {
+			defer wg.Done()
+			if err := us.Create(user); err != nil {
+				t.Errorf("Create() err = %s; want nil", err)
+			}
+		}(users[i])
+	}
+	wg.Wait()
+	defer func() {
+		for _, user := range users {
+			us.Delete(user)
 		}
-		err = us.Create(user)
+	}()
+
+	seen := make(map[int]bool)
+	for _, user := range users {
+		if seen[user.ID] {
+			t.Errorf("Create() user.ID = %d for two users; want unique IDs", user.ID)
+		}
+		seen[user.ID] = true
+		got, err := us.ByID(user.ID)
 		if err != nil {
-			t.Errorf("Create() err = %s; want nil", err)
+			t.Errorf("ByID() err = %s; want nil", err)
+			continue
 		}
-		if user.ID <= 0 {
-			t.Errorf("Create() user.ID = %d; want a positive value", user.ID)
+		if *got != *user {
+			t.Errorf("ByID() = %+v; want %+v", got, user)
 		}
-	})
+	}
+}
 
-	// t.Run("ByID", func(t *testing.T) {
-	// 	if beforeEach != nil {
-	// 		beforeEach()
-	// 	}
-	// 	// setup
-	// 	user := &suite.User{
-	// 		Email: "jon@calhoun.io",
-	// 	}
-	// 	us.Create(user)
-	// 	// teardown
-	// 	defer func() {
-	// 		us.Delete(user)
-	// 		if afterEach != nil {
-	// 			afterEach()
-	// 		}
-	// 	}()
-
-	// 	got, err := us.ByID(user.ID)
-	// 	if err != nil {
-	// 		t.Errorf("ByID() err = %s; want nil", err)
-	// 	}
-	// 	if got != user {
-	// 		t.Errorf("ByID() = %v; want %v", got, user)
-	// 	}
-	// })
-
-	//
+func testConcurrentCreateEmailTaken(t *testing.T, us suite.UserStore) {
+	const n = 20
+	email := gen.Email()
+	var mu sync.Mutex
+	var created []*suite.User
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := &suite.User{
+				Email: email,
+			}
+			err := us.Create(user)
+			switch {
+			case err == nil:
+				mu.Lock()
+				created = append(created, user)
+				mu.Unlock()
+			case !errors.Is(err, suite.ErrEmailTaken):
+				t.Errorf("Create() err = %v; want nil or %v", err, suite.ErrEmailTaken)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, user := range created {
+		us.Delete(user)
+	}
+	if len(created) != 1 {
+		t.Errorf("Create() succeeded %d times with the same email; want 1", len(created))
+	}
 }
@@ -0,0 +1,228 @@
+// Package view renders HTML pages from templates.
+//
+// Templates are read from an fs.FS, usually an embed.FS. Every page is
+// parsed along with all of the layouts in LayoutDir, and rendering starts
+// with the Layout template, which includes the page with
+// {{template "content" .}}:
+//
+//	layouts/default.gohtml:
+//		<html><body>{{template "content" .}}</body></html>
+//	home.gohtml:
+//		{{define "content"}}<h1>Welcome</h1>{{end}}
+//
+// Templates can also use the helper funcs flashes, csrfField and form,
+// described on Engine.
+package view
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/joncalhoun/twg/form"
+)
+
+const (
+	// DefaultLayoutDir is used when Engine.LayoutDir is empty.
+	DefaultLayoutDir = "layouts"
+	// DefaultLayout is used when Engine.Layout is empty.
+	DefaultLayout = "default.gohtml"
+	// Ext is the file extension of layout templates.
+	Ext = ".gohtml"
+)
+
+// Engine renders pages. It is safe for concurrent use once rendering has
+// started, and its fields shouldn't be changed after that.
+type Engine struct {
+	// FS holds the templates.
+	FS fs.FS
+	// Dir, if set, is a directory on disk with the same contents as FS.
+	// Templates are read from it and parsed again on every render so that
+	// changes show up without restarting; this is meant for development.
+	// Otherwise templates are parsed once and cached.
+	Dir string
+	// LayoutDir is the directory in FS with the layouts, and Layout is
+	// the name of the layout pages are rendered with. They default to
+	// DefaultLayoutDir and DefaultLayout.
+	LayoutDir string
+	Layout    string
+
+	// Funcs are added to every template.
+	Funcs template.FuncMap
+	// Field is the template used for each field by the form helper. See
+	// form.HTML.
+	Field *template.Template
+	// Flashes returns the flash messages to show for a request. It is
+	// called at most once per render, when a template first uses the
+	// flashes helper. If it is nil, flashes returns nil. Headers it sets
+	// on w, such as a cookie clearing the flashes, are only sent if the
+	// page renders, so the messages aren't lost to a 500 error.
+	Flashes func(w http.ResponseWriter, r *http.Request) interface{}
+	// CSRFField returns a hidden input with the request's CSRF token for
+	// the csrfField helper. If it is nil, csrfField returns nothing. Like
+	// those set by Flashes, headers it sets on w, such as a new session
+	// cookie, are only sent if the page renders.
+	CSRFField func(w http.ResponseWriter, r *http.Request) template.HTML
+	// ErrorLog is called with any errors rendering a page. It may be nil.
+	ErrorLog func(r *http.Request, err error)
+
+	mu    sync.Mutex
+	cache map[string]*template.Template
+}
+
+// helpers returns placeholders for the request specific helper funcs so
+// templates using them can be parsed. They are replaced when rendering.
+func helpers() template.FuncMap {
+	return template.FuncMap{
+		"flashes":   func() interface{} { return nil },
+		"csrfField": func() template.HTML { return "" },
+		"form": func(interface{}, ...[]form.FieldError) (template.HTML, error) {
+			return "", errors.New("view: form used outside of Render")
+		},
+	}
+}
+
+// Render renders the page with the status code. The page is written to
+// a buffer first, so if a template fails nothing has been sent yet and
+// the user gets a 500 error instead of a partial page.
+func (e *Engine) Render(w http.ResponseWriter, r *http.Request, status int, page string, data interface{}) {
+	var buf bytes.Buffer
+	hw := &headerWriter{header: make(http.Header)}
+	err := e.execute(&buf, hw, r, page, data)
+	if err != nil {
+		if e.ErrorLog != nil {
+			e.ErrorLog(r, err)
+		}
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+	for key, values := range hw.header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// headerWriter is the http.ResponseWriter given to helpers while a page
+// renders. It collects the headers they set so Render can drop them if the
+// page fails, and it doesn't let them write a response.
+type headerWriter struct {
+	header http.Header
+}
+
+func (hw *headerWriter) Header() http.Header {
+	return hw.header
+}
+
+func (hw *headerWriter) Write([]byte) (int, error) {
+	return 0, errors.New("view: helpers can't write the response")
+}
+
+func (hw *headerWriter) WriteHeader(int) {}
+
+func (e *Engine) execute(buf *bytes.Buffer, w http.ResponseWriter, r *http.Request, page string, data interface{}) error {
+	tpl, err := e.template(page)
+	if err != nil {
+		return err
+	}
+	tpl, err = tpl.Clone()
+	if err != nil {
+		return err
+	}
+	var (
+		flashes    interface{}
+		gotFlashes bool
+	)
+	tpl.Funcs(template.FuncMap{
+		"flashes": func() interface{} {
+			if !gotFlashes && e.Flashes != nil {
+				flashes = e.Flashes(w, r)
+			}
+			gotFlashes = true
+			return flashes
+		},
+		"csrfField": func() template.HTML {
+			if e.CSRFField == nil {
+				return ""
+			}
+			return e.CSRFField(w, r)
+		},
+		"form": func(v interface{}, errs ...[]form.FieldError) (template.HTML, error) {
+			if e.Field == nil {
+				return "", errors.New("view: Engine.Field is nil")
+			}
+			var all []form.FieldError
+			for _, fe := range errs {
+				all = append(all, fe...)
+			}
+			return form.HTML(e.Field, v, all...)
+		},
+	})
+	return tpl.ExecuteTemplate(buf, e.layout(), data)
+}
+
+// template returns the parsed page, using the cache unless Dir is set.
+func (e *Engine) template(page string) (*template.Template, error) {
+	if e.Dir != "" {
+		return e.parse(os.DirFS(e.Dir), page)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if tpl, ok := e.cache[page]; ok {
+		return tpl, nil
+	}
+	tpl, err := e.parse(e.FS, page)
+	if err != nil {
+		return nil, err
+	}
+	if e.cache == nil {
+		e.cache = make(map[string]*template.Template)
+	}
+	e.cache[page] = tpl
+	return tpl, nil
+}
+
+func (e *Engine) parse(fsys fs.FS, page string) (*template.Template, error) {
+	if fsys == nil {
+		return nil, errors.New("view: Engine.FS is nil")
+	}
+	layouts, err := fs.Glob(fsys, path.Join(e.layoutDir(), "*"+Ext))
+	if err != nil {
+		return nil, err
+	}
+	if len(layouts) == 0 {
+		return nil, fmt.Errorf("view: no layouts in %s", e.layoutDir())
+	}
+	tpl := template.New(page).Funcs(helpers()).Funcs(e.Funcs)
+	tpl, err = tpl.ParseFS(fsys, append(layouts, page)...)
+	if err != nil {
+		return nil, fmt.Errorf("view: parsing %s: %w", page, err)
+	}
+	if tpl.Lookup(e.layout()) == nil {
+		return nil, fmt.Errorf("view: layout %s not found", e.layout())
+	}
+	return tpl, nil
+}
+
+func (e *Engine) layoutDir() string {
+	if e.LayoutDir == "" {
+		return DefaultLayoutDir
+	}
+	return e.LayoutDir
+}
+
+func (e *Engine) layout() string {
+	if e.Layout == "" {
+		return DefaultLayout
+	}
+	return e.Layout
+}
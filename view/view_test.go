@@ -0,0 +1,227 @@
+package view_test
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/joncalhoun/twg/form"
+	"github.com/joncalhoun/twg/httpassert"
+	"github.com/joncalhoun/twg/view"
+)
+
+const layout = `<p>{{range flashes}}[{{.}}]{{end}}</p>{{template "content" .}}`
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/default.gohtml": {Data: []byte(layout)},
+		"layouts/bare.gohtml":    {Data: []byte(`{{template "content" .}}`)},
+		"home.gohtml":            {Data: []byte(`{{define "content"}}<h1>Hi, {{.}}</h1>{{end}}`)},
+		"form.gohtml":            {Data: []byte(`{{define "content"}}<form>{{csrfField}}{{form .Form .Errors}}</form>{{end}}`)},
+		"fail.gohtml":            {Data: []byte(`{{define "content"}}<h1>Partial</h1>{{fail}}{{end}}`)},
+		"csrf.gohtml":            {Data: []byte(`{{define "content"}}<form>{{csrfField}}</form>{{fail}}{{end}}`)},
+		"broken.gohtml":          {Data: []byte(`{{define "content"}}{{.Missing{{end}}`)},
+	}
+}
+
+func render(e *view.Engine, status int, page string, data interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.Render(w, r, status, page, data)
+	})
+}
+
+func TestEngine_Render(t *testing.T) {
+	e := &view.Engine{
+		FS: testFS(),
+		Flashes: func(w http.ResponseWriter, r *http.Request) interface{} {
+			return []string{"one", "two"}
+		},
+	}
+	httpassert.Harness{Handler: render(e, http.StatusTeapot, "home.gohtml", "<Bob>")}.
+		Get(t, "/").
+		Status(http.StatusTeapot).
+		Header("Content-Type", "text/html; charset=utf-8").
+		BodyEquals("<p>[one][two]</p><h1>Hi, &lt;Bob&gt;</h1>")
+
+	t.Run("layout", func(t *testing.T) {
+		e := &view.Engine{FS: testFS(), Layout: "bare.gohtml"}
+		httpassert.Harness{Handler: render(e, http.StatusOK, "home.gohtml", "Bob")}.
+			Get(t, "/").
+			Status(http.StatusOK).
+			BodyEquals("<h1>Hi, Bob</h1>")
+	})
+
+	t.Run("no flashes", func(t *testing.T) {
+		e := &view.Engine{FS: testFS()}
+		httpassert.Harness{Handler: render(e, http.StatusOK, "home.gohtml", "Bob")}.
+			Get(t, "/").
+			BodyEquals("<p></p><h1>Hi, Bob</h1>")
+	})
+}
+
+func TestEngine_Render_form(t *testing.T) {
+	e := &view.Engine{
+		FS:     testFS(),
+		Layout: "bare.gohtml",
+		Field:  template.Must(template.New("").Parse(`<input name="{{.Name}}" value="{{.Value}}">{{range .Errors}}<b>{{.}}</b>{{end}}`)),
+		CSRFField: func(w http.ResponseWriter, r *http.Request) template.HTML {
+			return template.HTML(`<input type="hidden" value="` + r.Header.Get("X-Token") + `">`)
+		},
+	}
+	data := struct {
+		Form   interface{}
+		Errors []form.FieldError
+	}{
+		Form:   struct{ Email string }{"bob@example.com"},
+		Errors: []form.FieldError{{Field: "Email", Error: "taken"}},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Token", "abc")
+	httpassert.Harness{Handler: render(e, http.StatusOK, "form.gohtml", data)}.
+		Do(t, r).
+		Status(http.StatusOK).
+		BodyEquals(`<form><input type="hidden" value="abc"><input name="Email" value="bob@example.com"><b>taken</b></form>`)
+}
+
+func TestEngine_Render_errors(t *testing.T) {
+	tests := map[string]struct {
+		engine *view.Engine
+		page   string
+	}{
+		"execute": {
+			engine: &view.Engine{FS: testFS(), Funcs: template.FuncMap{
+				"fail": func() (string, error) { return "", errors.New("boom") },
+			}},
+			page: "fail.gohtml",
+		},
+		"parse":          {&view.Engine{FS: testFS()}, "broken.gohtml"},
+		"missing page":   {&view.Engine{FS: testFS()}, "nope.gohtml"},
+		"missing layout": {&view.Engine{FS: testFS(), Layout: "nope.gohtml"}, "home.gohtml"},
+		"no layouts":     {&view.Engine{FS: testFS(), LayoutDir: "nope"}, "home.gohtml"},
+		"form without Field": {
+			engine: &view.Engine{FS: testFS()},
+			page:   "form.gohtml",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The fail func must exist when pages are parsed, even for
+			// engines that don't use it.
+			if tc.engine.Funcs == nil {
+				tc.engine.Funcs = template.FuncMap{"fail": func() string { return "" }}
+			}
+			var logged error
+			tc.engine.ErrorLog = func(r *http.Request, err error) {
+				logged = err
+			}
+			data := struct{ Form, Errors interface{} }{}
+			httpassert.Harness{Handler: render(tc.engine, http.StatusOK, tc.page, data)}.
+				Get(t, "/").
+				Status(http.StatusInternalServerError).
+				Header("Content-Type", "text/plain; charset=utf-8").
+				BodyEquals("Something went wrong\n")
+			if logged == nil {
+				t.Errorf("ErrorLog was not called; want it called with the error")
+			}
+		})
+	}
+}
+
+func TestEngine_Render_flashCookie(t *testing.T) {
+	funcs := template.FuncMap{"fail": func() string { return "" }}
+	flashes := func(w http.ResponseWriter, r *http.Request) interface{} {
+		http.SetCookie(w, &http.Cookie{Name: "flash", MaxAge: -1})
+		return []string{"saved"}
+	}
+
+	t.Run("rendered", func(t *testing.T) {
+		e := &view.Engine{FS: testFS(), Funcs: funcs, Flashes: flashes}
+		httpassert.Harness{Handler: render(e, http.StatusOK, "home.gohtml", "Bob")}.
+			Get(t, "/").
+			Status(http.StatusOK).
+			BodyEquals("<p>[saved]</p><h1>Hi, Bob</h1>").
+			Cookie("flash", "")
+	})
+
+	// If the page fails the flashes were never shown, so the cookie that
+	// clears them must not be sent.
+	t.Run("failed", func(t *testing.T) {
+		e := &view.Engine{FS: testFS(), Flashes: flashes, Funcs: template.FuncMap{
+			"fail": func() (string, error) { return "", errors.New("boom") },
+		}}
+		httpassert.Harness{Handler: render(e, http.StatusOK, "fail.gohtml", nil)}.
+			Get(t, "/").
+			Status(http.StatusInternalServerError).
+			NoCookie("flash")
+	})
+}
+
+func TestEngine_Render_csrfCookie(t *testing.T) {
+	csrfField := func(w http.ResponseWriter, r *http.Request) template.HTML {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "new"})
+		return `<input type="hidden" value="token">`
+	}
+	tests := map[string]struct {
+		fail     interface{}
+		wantCode int
+	}{
+		"rendered": {func() string { return "" }, http.StatusOK},
+		// A session started for a page the user never sees shouldn't be
+		// sent along with the error.
+		"failed": {func() (string, error) { return "", errors.New("boom") }, http.StatusInternalServerError},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := &view.Engine{
+				FS:        testFS(),
+				Layout:    "bare.gohtml",
+				Funcs:     template.FuncMap{"fail": tc.fail},
+				CSRFField: csrfField,
+			}
+			res := httpassert.Harness{Handler: render(e, http.StatusOK, "csrf.gohtml", nil)}.
+				Get(t, "/").
+				Status(tc.wantCode)
+			if tc.wantCode == http.StatusOK {
+				res.BodyEquals(`<form><input type="hidden" value="token"></form>`).Cookie("session", "new")
+			} else {
+				res.NoCookie("session")
+			}
+		})
+	}
+}
+
+func TestEngine_Render_reload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() err = %s; want nil", err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("WriteFile() err = %s; want nil", err)
+		}
+	}
+	write("layouts/default.gohtml", `{{template "content" .}}`)
+	write("home.gohtml", `{{define "content"}}v1{{end}}`)
+
+	cached := &view.Engine{FS: os.DirFS(dir)}
+	dev := &view.Engine{FS: os.DirFS(dir), Dir: dir}
+	check := func(e *view.Engine, want string) {
+		t.Helper()
+		httpassert.Harness{Handler: render(e, http.StatusOK, "home.gohtml", nil)}.
+			Get(t, "/").
+			BodyEquals(want)
+	}
+	check(cached, "v1")
+	check(dev, "v1")
+
+	write("home.gohtml", `{{define "content"}}v2{{end}}`)
+	check(cached, "v1")
+	check(dev, "v2")
+}